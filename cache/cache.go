@@ -12,8 +12,50 @@ type Cache interface {
 	Exists(ctx context.Context, key string) (bool, error)
 	Remove(ctx context.Context, key string) error
 	Scan(ctx context.Context, key string, value any) error
+	// GetOrLoad 读取缓存, 未命中时调用 loader 加载并写入缓存, 并发请求同一个 key 时只加载一次.
+	// loader 返回 nil 时不写入缓存, 返回 ErrNilValue
+	GetOrLoad(ctx context.Context, key string, value any, ttl time.Duration, loader Loader) error
+	// MGet 批量读取, 结果与 keys 一一对应, 通过 Item.Found 区分命中与未命中
+	MGet(ctx context.Context, keys ...string) ([]Item, error)
+	// MSet 批量写入, ttl 小于等于 0 表示不过期
+	MSet(ctx context.Context, values map[string]any, ttl time.Duration) error
+	// MRemove 批量删除, 不存在的 key 会被忽略
+	MRemove(ctx context.Context, keys ...string) error
+	// IncrBy 原子地增加计数并返回新值, key 不存在时从 0 开始, 创建时设置 ttl(小于等于 0 表示不过期)
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	Decr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// TTL 返回剩余的过期时间, 不过期时返回 InfiniteTTL, key 不存在时返回 ErrKeyNotFound
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Expire 重新设置过期时间, ttl 小于等于 0 时删除 key, key 不存在时返回 ErrKeyNotFound
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	// Persist 移除过期时间, key 不存在时返回 ErrKeyNotFound
+	Persist(ctx context.Context, key string) error
+}
+
+// Item 批量读取的结果
+type Item struct {
+	Key   string
+	Found bool
+	value any // 内存缓存中的原始值, Redis 中为 rawValue
+}
+
+// Scan 与对应后端的 Scan 语义一致, 未命中时返回 ErrKeyNotFound
+func (i Item) Scan(value any) error {
+	if !i.Found {
+		return ErrKeyNotFound
+	}
+	if raw, ok := i.value.(rawValue); ok {
+		return raw.decode(raw.data, value)
+	}
+	return scanValue(i.value, value)
 }
 
 var (
 	ErrKeyNotFound = errors.New("key not found in cache")
+	ErrNotInteger  = errors.New("value is not an integer")
+	ErrNotObtained = errors.New("lock not obtained")
+	ErrLockNotHeld = errors.New("lock not held")
+	ErrLockTTL     = errors.New("lock ttl must be at least 1ms")
+	ErrNilValue    = errors.New("loader returned a nil value")
 )
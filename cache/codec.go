@@ -0,0 +1,264 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"sync"
+)
+
+// Codec 写入 Redis 时的序列化方式, ID 写入数据头部, 取值范围 0-31 且不能重复
+type Codec interface {
+	ID() byte
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Compressor 压缩方式, ID 写入数据头部, 取值范围 1-3 且不能重复
+type Compressor interface {
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	// JSON 默认的序列化方式, 未压缩时不写入头部, 与旧数据及 INCR 兼容
+	JSON Codec = jsonCodec{}
+	// Msgpack 体积更小, 解码到 any 时整数不会变成 float64
+	Msgpack Codec = newMsgpackCodec()
+	// Gob 接口类型的值需要先调用 gob.Register
+	Gob Codec = gobCodec{}
+	// Protobuf 值必须实现 proto.Message
+	Protobuf Codec = protobufCodec{}
+
+	Snappy Compressor = snappyCompressor{}
+	Zstd   Compressor = zstdCompressor{}
+)
+
+// 数据头部: 最高位为 1, 中间 5 位为 Codec, 最低 2 位为 Compressor.
+// JSON 不可能以大于 0x7f 的字节开头, 没有头部的数据按 JSON 读取
+const (
+	headerFlag      = 0x80
+	headerCodecMask = 0x1f
+	headerCompMask  = 0x03
+)
+
+var (
+	codecMu     sync.RWMutex
+	codecs      = map[byte]Codec{}
+	compressors = map[byte]Compressor{}
+)
+
+func init() {
+	for _, c := range []Codec{JSON, Msgpack, Gob, Protobuf} {
+		codecs[c.ID()] = c
+	}
+	for _, c := range []Compressor{Snappy, Zstd} {
+		compressors[c.ID()] = c
+	}
+}
+
+// RegisterCodec 注册自定义的序列化方式, 切换回其他 Codec 后仍可读取旧数据.
+// ID 超出 0-31 或已被注册时返回错误, 应在初始化时调用
+func RegisterCodec(c Codec) error {
+	id := c.ID()
+	if id > headerCodecMask {
+		return fmt.Errorf("cache: codec id %d out of range", id)
+	}
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	if _, ok := codecs[id]; ok {
+		return fmt.Errorf("cache: codec %d already registered", id)
+	}
+	codecs[id] = c
+	return nil
+}
+
+// Encoding 设置 Redis 的序列化方式, 读取时根据头部自动识别, 切换时无需清空 Redis
+func Encoding(c Codec) RedisOption {
+	return redisOptionFunc(func(r *Redis) {
+		r.codec = c
+	})
+}
+
+// Compression 序列化后的数据超过 threshold 字节时压缩
+func Compression(c Compressor, threshold int) RedisOption {
+	return redisOptionFunc(func(r *Redis) {
+		r.compressor = c
+		r.threshold = threshold
+	})
+}
+
+// encode 序列化并按需压缩, 写入头部
+func (r *Redis) encode(v any) ([]byte, error) {
+	c := r.codec
+	if c == nil {
+		c = JSON
+	}
+	data, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var compID byte
+	if r.compressor != nil && len(data) > r.threshold {
+		if data, err = r.compressor.Compress(data); err != nil {
+			return nil, err
+		}
+		compID = r.compressor.ID()
+	}
+	if c.ID() == JSON.ID() && compID == 0 {
+		return data, nil
+	}
+	header := headerFlag | (c.ID()&headerCodecMask)<<2 | compID&headerCompMask
+	return append([]byte{header}, data...), nil
+}
+
+// decode 根据头部解压及反序列化, 与当前配置的 Codec 无关
+func (r *Redis) decode(data []byte, v any) error {
+	if len(data) == 0 || data[0]&headerFlag == 0 {
+		return json.Unmarshal(data, v)
+	}
+
+	header := data[0]
+	data = data[1:]
+	if id := header & headerCompMask; id != 0 {
+		comp, ok := compressors[id]
+		if !ok {
+			return fmt.Errorf("cache: unknown compressor %d", id)
+		}
+		var err error
+		if data, err = comp.Decompress(data); err != nil {
+			return err
+		}
+	}
+	id := header >> 2 & headerCodecMask
+	codecMu.RLock()
+	c, ok := codecs[id]
+	codecMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("cache: unknown codec %d", id)
+	}
+	return c.Unmarshal(data, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte { return 0 }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct {
+	h *codec.MsgpackHandle
+}
+
+func newMsgpackCodec() msgpackCodec {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	// 解码到 any 时使用 map[string]any, 与 JSON 一致
+	h.MapType = reflect.TypeOf(map[string]any(nil))
+	return msgpackCodec{h: h}
+}
+
+func (msgpackCodec) ID() byte { return 1 }
+
+func (c msgpackCodec) Marshal(v any) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, c.h).Encode(v)
+	return data, err
+}
+
+func (c msgpackCodec) Unmarshal(data []byte, v any) error {
+	return codec.NewDecoderBytes(data, c.h).Decode(v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ID() byte { return 2 }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ID() byte { return 3 }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.New("cache: value must be a proto.Message")
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal v 也可以是消息指针的指针, 如 Typed[*pb.User] 读取时传入的 **pb.User
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Pointer || val.IsNil() || val.Elem().Kind() != reflect.Pointer {
+		return errors.New("cache: value must be a proto.Message")
+	}
+	elem := reflect.New(val.Elem().Type().Elem())
+	m, ok := elem.Interface().(proto.Message)
+	if !ok {
+		return errors.New("cache: value must be a proto.Message")
+	}
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	val.Elem().Set(elem)
+	return nil
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) ID() byte { return 1 }
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// zstd 的编解码器会启动后台 goroutine, 首次使用时再创建; EncodeAll 和 DecodeAll 可以并发调用
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, _ := zstd.NewWriter(nil)
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil)
+		return dec
+	})
+)
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) ID() byte { return 2 }
+
+func (zstdCompressor) Compress(data []byte) ([]byte, error) {
+	return zstdEncoder().EncodeAll(data, nil), nil
+}
+
+func (zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	return zstdDecoder().DecodeAll(data, nil)
+}
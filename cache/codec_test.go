@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"bytes"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"strings"
+	"testing"
+	"time"
+)
+
+type codecValue struct {
+	Name    string
+	ID      int64
+	Data    []byte
+	Created time.Time
+}
+
+func TestCodec(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	want := codecValue{
+		Name:    strings.Repeat("a", 100),
+		ID:      1<<62 + 1,
+		Data:    []byte{0, 1, 2},
+		Created: time.Date(2024, 1, 2, 3, 4, 5, 6, loc),
+	}
+
+	for _, c := range []Codec{JSON, Msgpack, Gob} {
+		for _, comp := range []Compressor{nil, Snappy, Zstd} {
+			r := WrapRedis(nil, 0, Encoding(c), Compression(comp, 10))
+			data, err := r.encode(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c == JSON && comp == nil && data[0] != '{' {
+				t.Fatal("json without compression should not have header")
+			}
+
+			// 切换 Codec 后仍可读取旧数据
+			var got codecValue
+			if err = WrapRedis(nil, 0).decode(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != want.Name || got.ID != want.ID || !bytes.Equal(got.Data, want.Data) || !got.Created.Equal(want.Created) {
+				t.Fatalf("codec %d, got %+v", c.ID(), got)
+			}
+		}
+	}
+
+	// msgpack 解码到 any 时整数不会变成 float64
+	r := WrapRedis(nil, 0, Encoding(Msgpack))
+	data, _ := r.encode(map[string]any{"id": want.ID})
+	var m map[string]any
+	if err := r.decode(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := m["id"].(int64); !ok || id != want.ID {
+		t.Errorf("id should be int64, got %T", m["id"])
+	}
+
+	r = WrapRedis(nil, 0, Encoding(Protobuf), Compression(Zstd, 0))
+	data, err := r.encode(wrapperspb.String("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg wrapperspb.StringValue
+	if err = r.decode(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetValue() != "bar" {
+		t.Error("value should be bar")
+	}
+	if _, err = r.encode("bar"); err == nil {
+		t.Error("protobuf should reject non proto.Message")
+	}
+
+	// 解码到消息指针的指针, Typed[*pb.Msg] 使用
+	var ptr *wrapperspb.StringValue
+	if err = r.decode(data, &ptr); err != nil || ptr.GetValue() != "bar" {
+		t.Fatalf("unexpected value: %v, %v", ptr, err)
+	}
+
+	if err = r.decode([]byte{headerFlag | 31<<2}, &msg); err == nil {
+		t.Error("unknown codec should fail")
+	}
+}
+
+// idCodec 使用 JSON 序列化, ID 可自定义
+type idCodec struct {
+	jsonCodec
+	id byte
+}
+
+func (c idCodec) ID() byte { return c.id }
+
+func TestRegisterCodec(t *testing.T) {
+	if err := RegisterCodec(idCodec{id: JSON.ID()}); err == nil {
+		t.Error("duplicate codec should be rejected")
+	}
+	if err := RegisterCodec(idCodec{id: 32}); err == nil {
+		t.Error("codec id out of range should be rejected")
+	}
+
+	// 注册与解码并发执行
+	r := WrapRedis(nil, 0, Encoding(idCodec{id: 30}))
+	data, err := r.encode("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- RegisterCodec(idCodec{id: 30})
+	}()
+	var s string
+	_ = r.decode(data, &s)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err = r.decode(data, &s); err != nil || s != "foo" {
+		t.Fatalf("unexpected value: %s, %v", s, err)
+	}
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+func (c *cache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return c.IncrBy(ctx, key, 1, ttl)
+}
+
+func (c *cache) Decr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return c.IncrBy(ctx, key, -1, ttl)
+}
+
+func (c *cache) IncrBy(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	c.mu.Lock()
+	res := c.removeExpired(now.UnixNano())
+	ele, ok := c.elements[key]
+	if !ok || ele.expired(now.UnixNano()) {
+		res = append(res, c.set(c.newElement(key, delta, ttl, now))...)
+		c.mu.Unlock()
+		c.notify(res)
+		return delta, nil
+	}
+
+	n, ok := toInt64(ele.value)
+	if !ok {
+		c.mu.Unlock()
+		c.notify(res)
+		return 0, ErrNotInteger
+	}
+	// 原地修改, 保留原有的类型、过期时间及淘汰策略中的位置
+	n += delta
+	value, err := withInt64(ele.value, n)
+	if err != nil {
+		c.mu.Unlock()
+		c.notify(res)
+		return 0, err
+	}
+	ele.value = value
+	if c.policy != nil {
+		c.policy.access(ele)
+	}
+	c.mu.Unlock()
+	c.notify(res)
+	return n, nil
+}
+
+func (c *cache) TTL(_ context.Context, key string) (time.Duration, error) {
+	now := time.Now().UnixNano()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ele, ok := c.elements[key]
+	if !ok || ele.expired(now) {
+		return 0, ErrKeyNotFound
+	}
+	if ele.expiry <= 0 {
+		return InfiniteTTL, nil
+	}
+	return time.Duration(ele.expiry - now), nil
+}
+
+func (c *cache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	now := time.Now()
+	c.mu.Lock()
+	ele, ok := c.elements[key]
+	if !ok || ele.expired(now.UnixNano()) {
+		c.mu.Unlock()
+		return ErrKeyNotFound
+	}
+	if ttl <= 0 {
+		c.removeElement(ele)
+		c.mu.Unlock()
+		c.notify([]evicted{{ele, EvictExpired}})
+		return nil
+	}
+	ele.expiry = now.Add(ttl).UnixNano()
+	if ele.index >= 0 {
+		heap.Fix(&c.expiries, ele.index)
+	} else {
+		heap.Push(&c.expiries, ele)
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *cache) Persist(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ele, ok := c.elements[key]
+	if !ok || ele.expired(time.Now().UnixNano()) {
+		return ErrKeyNotFound
+	}
+	ele.expiry = InfiniteTTL
+	if ele.index >= 0 {
+		heap.Remove(&c.expiries, ele.index)
+	}
+	return nil
+}
+
+// withInt64 将 n 转换为与 v 相同的整数类型, 使 Set(k, 5) 后仍可以 Scan 到 int
+func withInt64(v any, n int64) (any, error) {
+	val := reflect.New(reflect.TypeOf(v)).Elem()
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if val.OverflowInt(n) {
+			return nil, fmt.Errorf("cache: %d overflows %s", n, val.Type())
+		}
+		val.SetInt(n)
+	default:
+		if n < 0 || val.OverflowUint(uint64(n)) {
+			return nil, fmt.Errorf("cache: %d overflows %s", n, val.Type())
+		}
+		val.SetUint(uint64(n))
+	}
+	return val.Interface(), nil
+}
+
+// toInt64 计数器可能由 Set 写入任意整数类型
+func toInt64(v any) (int64, bool) {
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(val.Uint()), true
+	default:
+		return 0, false
+	}
+}
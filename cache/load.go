@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"golang.org/x/sync/singleflight"
+	"reflect"
+)
+
+// Loader 缓存未命中时加载数据, 返回的值会写入缓存.
+// 不能返回 nil, 需要缓存"不存在"时应返回零值或自定义的占位值
+type Loader func(ctx context.Context) (any, error)
+
+// call 调用 loader, 结果为 nil 时返回 ErrNilValue, 调用方不会写入缓存
+func (l Loader) call(ctx context.Context) (any, error) {
+	v, err := l(ctx)
+	if err == nil && v == nil {
+		return nil, ErrNilValue
+	}
+	return v, err
+}
+
+// rawValue 后端中未解码的原始数据
+type rawValue struct {
+	data   []byte
+	decode func(data []byte, v any) error
+}
+
+// loadOnce 同一进程内同一个 key 只执行一次 fn, 单个调用方取消不影响其他等待者
+func loadOnce(ctx context.Context, group *singleflight.Group, key string, fn func(ctx context.Context) (any, error)) (any, error) {
+	ch := group.DoChan(key, func() (any, error) {
+		return fn(context.WithoutCancel(ctx))
+	})
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// assign 将加载的值写入 value, 类型不一致时通过 JSON 转换
+func assign(value any, v any) error {
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return errors.New("value must be a non-nil pointer")
+	}
+	switch raw := v.(type) {
+	case rawValue:
+		return raw.decode(raw.data, value)
+	case json.RawMessage:
+		return json.Unmarshal(raw, value)
+	}
+	if v != nil && reflect.TypeOf(v).AssignableTo(val.Elem().Type()) {
+		val.Elem().Set(reflect.ValueOf(v))
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
@@ -0,0 +1,347 @@
+package cache
+
+import (
+	"context"
+	"github.com/dmzlingyin/utils/log"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinBackoff = 10 * time.Millisecond
+	defaultMaxBackoff = 500 * time.Millisecond
+)
+
+// Locker 跨实例的互斥锁
+type Locker interface {
+	// Lock 阻塞直到获取锁或 ctx 结束, 获取失败时按退避时间重试
+	Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+	// TryLock 只尝试一次, 锁被其他调用方持有时返回 ErrNotObtained
+	TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+}
+
+type LockerOption interface {
+	apply(*locker)
+}
+
+type lockerOptionFunc func(*locker)
+
+func (f lockerOptionFunc) apply(l *locker) {
+	f(l)
+}
+
+// Backoff 获取锁失败后的重试间隔, 从 min 开始翻倍直到 max, 并加入随机抖动
+func Backoff(min, max time.Duration) LockerOption {
+	return lockerOptionFunc(func(l *locker) {
+		l.minBackoff = min
+		l.maxBackoff = max
+	})
+}
+
+// RenewInterval 自动续期的间隔, 默认为 ttl 的 1/3, 小于 0 时不自动续期
+func RenewInterval(d time.Duration) LockerOption {
+	return lockerOptionFunc(func(l *locker) {
+		l.renewInterval = d
+	})
+}
+
+// lockBackend 锁的存储, owner 用于校验持有者, 避免释放他人的锁
+type lockBackend interface {
+	// acquire 获取成功时返回 fencing token, 否则返回 0
+	acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, error)
+	extend(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	release(ctx context.Context, key, owner string) (bool, error)
+}
+
+type locker struct {
+	backend       lockBackend
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	renewInterval time.Duration
+}
+
+func newLocker(backend lockBackend, opts ...LockerOption) *locker {
+	l := &locker{
+		backend:    backend,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt.apply(l)
+	}
+	return l
+}
+
+func (l *locker) Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	backoff := l.minBackoff
+	for {
+		lock, err := l.TryLock(ctx, key, ttl)
+		if err != ErrNotObtained {
+			return lock, err
+		}
+
+		// 随机抖动避免多个实例同时重试
+		wait := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, l.maxBackoff)
+	}
+}
+
+func (l *locker) TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	if err := checkLockTTL(ttl); err != nil {
+		return nil, err
+	}
+	owner := uuid.NewString()
+	start := time.Now()
+	fence, err := l.backend.acquire(ctx, key, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if fence == 0 {
+		return nil, ErrNotObtained
+	}
+
+	lock := &Lock{
+		key:      key,
+		owner:    owner,
+		fence:    fence,
+		ttl:      ttl,
+		extended: start,
+		backend:  l.backend,
+		stop:     make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	if l.renewInterval >= 0 {
+		go lock.renew(l.renewInterval)
+	}
+	return lock, nil
+}
+
+// checkLockTTL 锁以毫秒为单位过期, 不足 1ms 时 Redis 拒绝 PX 0, PEXPIRE 0 会直接删除锁
+func checkLockTTL(ttl time.Duration) error {
+	if ttl < time.Millisecond {
+		return ErrLockTTL
+	}
+	return nil
+}
+
+// Lock 已获取的锁
+type Lock struct {
+	key     string
+	owner   string
+	fence   int64
+	backend lockBackend
+
+	mu       sync.Mutex
+	ttl      time.Duration
+	extended time.Time // 上次成功续期(或获取)时发出请求的时间
+	stop     chan struct{}
+	lost     chan struct{}
+	stopOnce sync.Once
+	lostOnce sync.Once
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Fence 同一个 key 每次获取锁时单调递增, 写入下游时携带并拒绝更小的值,
+// 可以避免锁过期后旧的持有者覆盖新持有者的数据
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+// Lost 续期时发现锁已过期或被他人持有时关闭, 调用方应停止受保护的操作
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Extend 将锁的过期时间重置为 ttl, 之后的自动续期也使用该 ttl, 锁已失效时返回 ErrLockNotHeld
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	if err := checkLockTTL(ttl); err != nil {
+		return err
+	}
+	start := time.Now()
+	ok, err := l.backend.extend(ctx, l.key, l.owner, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		l.markLost()
+		return ErrLockNotHeld
+	}
+	l.mu.Lock()
+	l.ttl = ttl
+	l.extended = start
+	l.mu.Unlock()
+	return nil
+}
+
+// Unlock 停止自动续期并释放锁, 锁已过期或被他人持有时返回 ErrLockNotHeld
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	ok, err := l.backend.release(ctx, l.key, l.owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// renew 定期续期, 网络错误时在下个周期重试, 锁已失效或距上次成功续期已超过 ttl 时停止
+func (l *Lock) renew(interval time.Duration) {
+	for {
+		l.mu.Lock()
+		ttl := l.ttl
+		l.mu.Unlock()
+		wait := interval
+		if wait == 0 {
+			wait = ttl / 3
+		}
+
+		select {
+		case <-l.stop:
+			return
+		case <-time.After(wait):
+		}
+		start := time.Now()
+		ok, err := l.backend.extend(context.Background(), l.key, l.owner, ttl)
+		if err != nil {
+			log.Errorf("renew lock %s error: %s", l.key, err)
+			// 一直无法续期时锁在服务端已经过期, 可能已被他人获取
+			l.mu.Lock()
+			expired := time.Since(l.extended) >= l.ttl
+			l.mu.Unlock()
+			if expired {
+				l.markLost()
+				return
+			}
+			continue
+		}
+		if !ok {
+			l.markLost()
+			return
+		}
+		l.mu.Lock()
+		l.extended = start
+		l.mu.Unlock()
+	}
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() { close(l.lost) })
+}
+
+// acquireScript 获取锁并递增 fencing token, 两个 key 使用相同的 hash tag, 集群模式下位于同一个 slot
+var acquireScript = redis.NewScript(`
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return 0`)
+
+// extendScript 只续期自己持有的锁
+var extendScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// NewRedisLocker 与缓存共用 Redis 客户端.
+// 锁保存在 lock:{key}, fencing token 保存在 lock:{key}:fence 且不过期
+func NewRedisLocker(r *Redis, opts ...LockerOption) Locker {
+	return newLocker(redisLock{client: r.client}, opts...)
+}
+
+type redisLock struct {
+	client redis.UniversalClient
+}
+
+func (r redisLock) acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	return acquireScript.Run(ctx, r.client, []string{lockKey(key), lockKey(key) + ":fence"}, owner, ttl.Milliseconds()).Int64()
+}
+
+func (r redisLock) extend(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	n, err := extendScript.Run(ctx, r.client, []string{lockKey(key)}, owner, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+func (r redisLock) release(ctx context.Context, key, owner string) (bool, error) {
+	n, err := unlockScript.Run(ctx, r.client, []string{lockKey(key)}, owner).Int64()
+	return n == 1, err
+}
+
+func lockKey(key string) string {
+	return "lock:{" + key + "}"
+}
+
+// NewMemoryLocker 进程内的实现, 用于测试及单实例部署
+func NewMemoryLocker(opts ...LockerOption) Locker {
+	return newLocker(&memoryLock{
+		owners: make(map[string]memoryOwner),
+		fences: make(map[string]int64),
+	}, opts...)
+}
+
+type memoryLock struct {
+	mu     sync.Mutex
+	owners map[string]memoryOwner
+	fences map[string]int64
+}
+
+type memoryOwner struct {
+	owner  string
+	expiry time.Time
+}
+
+func (m *memoryLock) acquire(_ context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held(key, "") {
+		return 0, nil
+	}
+	m.owners[key] = memoryOwner{owner: owner, expiry: time.Now().Add(ttl)}
+	m.fences[key]++
+	return m.fences[key], nil
+}
+
+func (m *memoryLock) extend(_ context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.held(key, owner) {
+		return false, nil
+	}
+	m.owners[key] = memoryOwner{owner: owner, expiry: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (m *memoryLock) release(_ context.Context, key, owner string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.held(key, owner) {
+		return false, nil
+	}
+	delete(m.owners, key)
+	return true, nil
+}
+
+// held 锁未过期且由 owner 持有时返回 true, owner 为空时只检查是否被持有, 需持有 m.mu
+func (m *memoryLock) held(key, owner string) bool {
+	o, ok := m.owners[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(o.expiry) {
+		delete(m.owners, key)
+		return false
+	}
+	return owner == "" || o.owner == owner
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLocker(t *testing.T) {
+	testLocker(t, NewMemoryLocker(Backoff(time.Millisecond, 10*time.Millisecond)))
+}
+
+func testLocker(t *testing.T, l Locker) {
+	ctx := context.Background()
+	a, err := l.Lock(ctx, "job", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.TryLock(ctx, "job", time.Second); !errors.Is(err, ErrNotObtained) {
+		t.Fatalf("lock should be held, got %v", err)
+	}
+
+	// 阻塞获取在 ctx 结束时返回
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err = l.Lock(timeout, "job", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lock should time out, got %v", err)
+	}
+
+	// 不足 1ms 的 ttl 会被 Redis 拒绝或直接删除锁
+	for _, ttl := range []time.Duration{0, -time.Second, 500 * time.Microsecond} {
+		if _, err = l.TryLock(ctx, "other", ttl); !errors.Is(err, ErrLockTTL) {
+			t.Fatalf("TryLock(%v) should be rejected, got %v", ttl, err)
+		}
+		if err = a.Extend(ctx, ttl); !errors.Is(err, ErrLockTTL) {
+			t.Fatalf("Extend(%v) should be rejected, got %v", ttl, err)
+		}
+	}
+	if _, err = l.TryLock(ctx, "job", time.Second); !errors.Is(err, ErrNotObtained) {
+		t.Fatalf("lock should still be held, got %v", err)
+	}
+
+	if err = a.Extend(ctx, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("lock should be released, got %v", err)
+	}
+
+	// 同一时刻只有一个持有者, fencing token 单调递增
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	holders, last := 0, a.Fence()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := l.Lock(ctx, "job", time.Second)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			holders++
+			if holders > 1 || lock.Fence() <= last {
+				t.Errorf("holders %d, fence %d, last %d", holders, lock.Fence(), last)
+			}
+			last = lock.Fence()
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			if err := lock.Unlock(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLockRenew(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	a, err := l.Lock(ctx, "renew", 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 自动续期后锁仍被持有
+	time.Sleep(100 * time.Millisecond)
+	if _, err = l.TryLock(ctx, "renew", time.Second); !errors.Is(err, ErrNotObtained) {
+		t.Fatalf("lock should be renewed, got %v", err)
+	}
+	_ = a.Unlock(ctx)
+
+	l = NewMemoryLocker(RenewInterval(-1))
+	b, err := l.Lock(ctx, "renew", 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	c, err := l.TryLock(ctx, "renew", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Fence() <= b.Fence() {
+		t.Error("fence should increase")
+	}
+	if err = b.Extend(ctx, time.Second); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("expired lock should not be extended, got %v", err)
+	}
+	select {
+	case <-b.Lost():
+	default:
+		t.Error("lost should be closed")
+	}
+	_ = c.Unlock(ctx)
+}
+
+// failingLock 续期时返回网络错误
+type failingLock struct {
+	*memoryLock
+	fail atomic.Bool
+}
+
+func (f *failingLock) extend(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	if f.fail.Load() {
+		return false, errors.New("network error")
+	}
+	return f.memoryLock.extend(ctx, key, owner, ttl)
+}
+
+func TestLockRenewError(t *testing.T) {
+	ctx := context.Background()
+	backend := &failingLock{memoryLock: &memoryLock{
+		owners: make(map[string]memoryOwner),
+		fences: make(map[string]int64),
+	}}
+	l := newLocker(backend)
+	a, err := l.Lock(ctx, "renew", 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Unlock(ctx)
+	// 续期一直失败, 超过 ttl 后视为丢失
+	backend.fail.Store(true)
+	select {
+	case <-a.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost should be closed after ttl")
+	}
+}
@@ -1,18 +1,90 @@
 package cache
 
 import (
+	"container/heap"
 	"context"
 	"errors"
+	"golang.org/x/sync/singleflight"
+	"math/bits"
+	"math/rand/v2"
 	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	InfiniteTTL = -1
+
+	// readBufferSize 每个分段缓存的访问记录数, 任一分段写满后尝试加写锁批量提交给淘汰策略
+	readBufferSize = 16
+	// maxReadStripes 访问记录的最大分段数, 默认与 GOMAXPROCS 相同
+	maxReadStripes = 64
+)
+
+// EvictReason 元素被移出缓存的原因
+type EvictReason int
+
+const (
+	EvictExpired  EvictReason = iota + 1 // 过期
+	EvictCapacity                        // 超出容量限制
+	EvictRemoved                         // 调用 Remove 删除
+	EvictReplaced                        // 被新的值覆盖
 )
 
+type MemoryOption interface {
+	apply(*cache)
+}
+
+type memoryOptionFunc func(*cache)
+
+func (f memoryOptionFunc) apply(c *cache) {
+	f(c)
+}
+
+// MaxEntries 限制元素数量, 超出时按淘汰策略移除
+func MaxEntries(n int) MemoryOption {
+	return memoryOptionFunc(func(c *cache) {
+		c.maxEntries = n
+	})
+}
+
+// MaxBytes 限制元素的估算总大小, 超出时按淘汰策略移除
+func MaxBytes(n int64) MemoryOption {
+	return memoryOptionFunc(func(c *cache) {
+		c.maxBytes = n
+	})
+}
+
+// Eviction 设置超出容量时的淘汰策略, 默认 LRU
+func Eviction(p EvictionPolicy) MemoryOption {
+	return memoryOptionFunc(func(c *cache) {
+		c.policyType = p
+	})
+}
+
+// KeyHash 自定义分片缓存的 key 哈希函数, 默认 FNV-1a, 仅对 NewSharded 生效
+func KeyHash(fn func(key string) uint64) MemoryOption {
+	return memoryOptionFunc(func(c *cache) {
+		c.hash = fn
+	})
+}
+
+// SizeFunc 自定义元素大小的估算方式, 默认通过反射粗略估算
+func SizeFunc(fn func(key string, value any) int64) MemoryOption {
+	return memoryOptionFunc(func(c *cache) {
+		c.sizer = fn
+	})
+}
+
+// OnEvict 元素被移出缓存时回调, 在锁外执行
+func OnEvict(fn func(key string, value any, reason EvictReason)) MemoryOption {
+	return memoryOptionFunc(func(c *cache) {
+		c.onEvict = fn
+	})
+}
+
 type Memory struct {
 	*cache
 }
@@ -22,14 +94,53 @@ type cache struct {
 	elements map[string]*Element
 	ttl      time.Duration
 	evictor  *Evictor
+	group    singleflight.Group
+
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	policyType EvictionPolicy
+	policy     policy // 未限制容量时为 nil
+	expiries   expiryHeap
+	sizer      func(key string, value any) int64
+	onEvict    func(key string, value any, reason EvictReason)
+	hash       func(key string) uint64 // 仅 NewSharded 使用
+
+	readStripes []readStripe // 尚未提交给淘汰策略的访问记录, 分段以减少读取之间的竞争
+	readsFull   atomic.Bool
+}
+
+// readStripe 访问记录的一个分段, 填充到一个缓存行避免伪共享
+type readStripe struct {
+	mu    sync.Mutex
+	reads []*Element
+	_     [32]byte
 }
 
 type Element struct {
+	key    string
 	value  any
 	expiry int64
+	size   int64
+	index  int // 在过期堆中的位置, 不过期时为 -1
+	node   any // 淘汰策略使用的节点
 }
 
-func NewMemory(ttl time.Duration, evictInterval time.Duration) Cache {
+// evicted 待回调的元素
+type evicted struct {
+	ele    *Element
+	reason EvictReason
+}
+
+func NewMemory(ttl time.Duration, evictInterval time.Duration, opts ...MemoryOption) Cache {
+	C := &Memory{newCache(ttl, evictInterval, opts...)}
+	if C.evictor != nil {
+		runtime.SetFinalizer(C, shutdown)
+	}
+	return C
+}
+
+func newCache(ttl time.Duration, evictInterval time.Duration, opts ...MemoryOption) *cache {
 	c := &cache{
 		elements: make(map[string]*Element),
 		ttl:      ttl,
@@ -37,19 +148,21 @@ func NewMemory(ttl time.Duration, evictInterval time.Duration) Cache {
 	if ttl <= 0 {
 		c.ttl = InfiniteTTL
 	}
+	for _, opt := range opts {
+		opt.apply(c)
+	}
+	if c.maxEntries > 0 || c.maxBytes > 0 {
+		c.policy = newPolicy(c.policyType)
+		c.readStripes = make([]readStripe, readStripeCount())
+	}
+	if c.maxBytes > 0 && c.sizer == nil {
+		c.sizer = approxSize
+	}
 
-	C := &Memory{c}
 	if evictInterval > 0 {
-		c.evictor = &Evictor{
-			interval: evictInterval,
-			stop:     make(chan bool),
-			cache:    c,
-		}
-		go c.evictor.run()
-		runtime.SetFinalizer(C, shutdown)
+		c.evictor = newEvictor(evictInterval, c)
 	}
-
-	return C
+	return c
 }
 
 func (c *cache) Set(ctx context.Context, key string, value any) error {
@@ -57,18 +170,76 @@ func (c *cache) Set(ctx context.Context, key string, value any) error {
 }
 
 func (c *cache) SetWithTTL(_ context.Context, key string, value any, ttl time.Duration) error {
+	now := time.Now()
+	ele := c.newElement(key, value, ttl, now)
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	// 写入时顺带清理已过期的元素, 未开启 Evictor 时也不会无限增长
+	res := c.removeExpired(now.UnixNano())
+	res = append(res, c.set(ele)...)
+	c.mu.Unlock()
+
+	c.notify(res)
+	return nil
+}
+
+func (c *cache) MSet(_ context.Context, values map[string]any, ttl time.Duration) error {
+	now := time.Now()
+	elements := make([]*Element, 0, len(values))
+	for key, value := range values {
+		elements = append(elements, c.newElement(key, value, ttl, now))
+	}
+
+	c.mu.Lock()
+	res := c.removeExpired(now.UnixNano())
+	for _, ele := range elements {
+		res = append(res, c.set(ele)...)
+	}
+	c.mu.Unlock()
+
+	c.notify(res)
+	return nil
+}
 
+func (c *cache) newElement(key string, value any, ttl time.Duration, now time.Time) *Element {
 	ele := &Element{
+		key:    key,
 		value:  value,
-		expiry: time.Now().Add(ttl).UnixNano(),
+		expiry: now.Add(ttl).UnixNano(),
+		index:  -1,
 	}
 	if ttl <= 0 {
 		ele.expiry = InfiniteTTL
 	}
-	c.elements[key] = ele
-	return nil
+	if c.sizer != nil {
+		ele.size = c.sizer(key, value)
+	}
+	return ele
+}
+
+// set 写入元素并返回被移除的元素, 需持有写锁
+func (c *cache) set(ele *Element) []evicted {
+	var res []evicted
+	if old, ok := c.elements[ele.key]; ok {
+		c.removeElement(old)
+		res = append(res, evicted{old, EvictReplaced})
+	}
+	// 单个元素超过大小限制时不写入
+	if c.maxBytes > 0 && ele.size > c.maxBytes {
+		return append(res, evicted{ele, EvictCapacity})
+	}
+	// 先淘汰已有元素再写入, 避免 LFU 下新元素被立即淘汰
+	if c.policy != nil {
+		c.applyReads()
+		res = append(res, c.makeRoom(ele.size)...)
+		c.policy.add(ele)
+	}
+	c.elements[ele.key] = ele
+	c.bytes += ele.size
+	if ele.expiry > 0 {
+		heap.Push(&c.expiries, ele)
+	}
+	return res
 }
 
 func (c *cache) Exists(_ context.Context, key string) (bool, error) {
@@ -78,32 +249,153 @@ func (c *cache) Exists(_ context.Context, key string) (bool, error) {
 	if !ok {
 		return false, nil
 	}
-	if v.expiry > 0 && time.Now().UnixNano() > v.expiry {
+	if v.expired(time.Now().UnixNano()) {
 		return false, nil
 	}
 	return true, nil
 }
 
 func (c *cache) Remove(ctx context.Context, key string) error {
-	exists, err := c.Exists(ctx, key)
-	if err != nil {
-		return err
-	}
-	if !exists {
-		return nil
-	}
+	return c.MRemove(ctx, key)
+}
+
+func (c *cache) MRemove(_ context.Context, keys ...string) error {
+	var res []evicted
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	delete(c.elements, key)
+	for _, key := range keys {
+		if ele, ok := c.elements[key]; ok {
+			c.removeElement(ele)
+			res = append(res, evicted{ele, EvictRemoved})
+		}
+	}
+	c.mu.Unlock()
+
+	c.notify(res)
 	return nil
 }
 
 func (c *cache) Scan(_ context.Context, key string, value any) error {
 	v, ok := c.get(key)
 	if !ok {
-		return errors.New("key not found in cache")
+		return ErrKeyNotFound
 	}
+	return scanValue(v, value)
+}
+
+func (c *cache) MGet(_ context.Context, keys ...string) ([]Item, error) {
+	items := make([]Item, len(keys))
+	now := time.Now().UnixNano()
+	unlock := c.lockRead()
+	for i, key := range keys {
+		items[i].Key = key
+		items[i].value, items[i].Found = c.lookup(key, now)
+	}
+	unlock()
+	return items, nil
+}
+
+func (c *cache) GetOrLoad(ctx context.Context, key string, value any, ttl time.Duration, loader Loader) error {
+	if v, ok := c.get(key); ok {
+		return assign(value, v)
+	}
+	v, err := loadOnce(ctx, &c.group, key, func(ctx context.Context) (any, error) {
+		// 等待期间其他调用方可能已经写入
+		if v, ok := c.get(key); ok {
+			return v, nil
+		}
+		v, err := loader.call(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return v, c.SetWithTTL(ctx, key, v, ttl)
+	})
+	if err != nil {
+		return err
+	}
+	return assign(value, v)
+}
 
+func (c *cache) get(key string) (any, bool) {
+	defer c.lockRead()()
+	return c.lookup(key, time.Now().UnixNano())
+}
+
+// lockRead 加读锁并返回解锁函数, 解锁后访问记录写满时尝试提交给淘汰策略
+func (c *cache) lockRead() func() {
+	c.mu.RLock()
+	return func() {
+		c.mu.RUnlock()
+		c.flushReads()
+	}
+}
+
+// lookup 需持有 lockRead 返回的锁
+func (c *cache) lookup(key string, now int64) (any, bool) {
+	v, ok := c.elements[key]
+	if !ok {
+		return nil, false
+	}
+	if v.expired(now) {
+		return nil, false
+	}
+	if c.policy != nil {
+		c.recordRead(v)
+	}
+	return v.value, true
+}
+
+// recordRead 随机选择一个分段记录访问, 分段被占用或已满时丢弃该记录, 只影响淘汰的精确度
+func (c *cache) recordRead(ele *Element) {
+	s := &c.readStripes[rand.Uint32()&uint32(len(c.readStripes)-1)]
+	if !s.mu.TryLock() {
+		return
+	}
+	if len(s.reads) < readBufferSize {
+		s.reads = append(s.reads, ele)
+	}
+	full := len(s.reads) >= readBufferSize
+	s.mu.Unlock()
+	if full {
+		c.readsFull.Store(true)
+	}
+}
+
+// flushReads 有分段写满时提交访问记录, 写锁被占用时放弃, 由之后的读写提交
+func (c *cache) flushReads() {
+	if c.policy == nil || !c.readsFull.Load() {
+		return
+	}
+	if c.mu.TryLock() {
+		c.applyReads()
+		c.mu.Unlock()
+	}
+}
+
+// applyReads 按分段更新淘汰策略, 已被移除的元素跳过, 需持有写锁
+func (c *cache) applyReads() {
+	c.readsFull.Store(false)
+	for i := range c.readStripes {
+		s := &c.readStripes[i]
+		s.mu.Lock()
+		for j, ele := range s.reads {
+			if ele.node != nil {
+				c.policy.access(ele)
+			}
+			s.reads[j] = nil
+		}
+		s.reads = s.reads[:0]
+		s.mu.Unlock()
+	}
+}
+
+// readStripeCount 不小于 GOMAXPROCS 的 2 的幂
+func readStripeCount() int {
+	n := min(runtime.GOMAXPROCS(0), maxReadStripes)
+	return 1 << bits.Len(uint(n-1))
+}
+
+// scanValue 内存缓存中的值需要与 value 的类型完全一致
+func scanValue(v any, value any) error {
 	val := reflect.ValueOf(value)
 	if val.Kind() != reflect.Ptr || val.IsNil() {
 		return errors.New("value must be a non-nil pointer")
@@ -113,28 +405,74 @@ func (c *cache) Scan(_ context.Context, key string, value any) error {
 		return errors.New("type mismatch")
 	}
 	elem.Set(reflect.ValueOf(v))
-
 	return nil
 }
 
-func (c *cache) get(key string) (any, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// removeElement 从 map、过期堆及淘汰策略中移除元素, 需持有写锁
+func (c *cache) removeElement(ele *Element) {
+	delete(c.elements, ele.key)
+	c.bytes -= ele.size
+	if ele.index >= 0 {
+		heap.Remove(&c.expiries, ele.index)
+	}
+	if c.policy != nil {
+		c.policy.remove(ele)
+	}
+}
 
-	v, ok := c.elements[key]
-	if !ok {
-		return nil, false
+// removeExpired 移除所有已过期的元素, 需持有写锁
+func (c *cache) removeExpired(now int64) []evicted {
+	var res []evicted
+	for len(c.expiries) > 0 && c.expiries[0].expired(now) {
+		ele := c.expiries[0]
+		c.removeElement(ele)
+		res = append(res, evicted{ele, EvictExpired})
 	}
-	if v.expiry > 0 && time.Now().UnixNano() > v.expiry {
-		return nil, false
+	return res
+}
+
+// makeRoom 按淘汰策略移除元素, 直到可以写入 size 大小的新元素, 需持有写锁
+func (c *cache) makeRoom(size int64) []evicted {
+	var res []evicted
+	for (c.maxEntries > 0 && len(c.elements) >= c.maxEntries) || (c.maxBytes > 0 && c.bytes+size > c.maxBytes) {
+		ele := c.policy.victim()
+		if ele == nil {
+			break
+		}
+		c.removeElement(ele)
+		res = append(res, evicted{ele, EvictCapacity})
 	}
-	return v.value, true
+	return res
 }
 
+func (c *cache) notify(res []evicted) {
+	if c.onEvict == nil {
+		return
+	}
+	for _, r := range res {
+		c.onEvict(r.ele.key, r.ele.value, r.reason)
+	}
+}
+
+func (e *Element) expired(now int64) bool {
+	return e.expiry > 0 && now > e.expiry
+}
+
+// Evictor 定期清理过期元素, 分片缓存逐个分片加锁, 不会阻塞整个缓存
 type Evictor struct {
 	interval time.Duration
 	stop     chan bool
-	cache    *cache
+	caches   []*cache
+}
+
+func newEvictor(interval time.Duration, caches ...*cache) *Evictor {
+	e := &Evictor{
+		interval: interval,
+		stop:     make(chan bool),
+		caches:   caches,
+	}
+	go e.run()
+	return e
 }
 
 func (e *Evictor) run() {
@@ -151,13 +489,13 @@ func (e *Evictor) run() {
 	}
 }
 
+// evict 过期堆按到期时间排序, 只需处理堆顶已过期的元素
 func (e *Evictor) evict() {
-	e.cache.mu.Lock()
-	defer e.cache.mu.Unlock()
-	for k, v := range e.cache.elements {
-		if v.expiry > 0 && time.Now().UnixNano() > v.expiry {
-			delete(e.cache.elements, k)
-		}
+	for _, c := range e.caches {
+		c.mu.Lock()
+		res := c.removeExpired(time.Now().UnixNano())
+		c.mu.Unlock()
+		c.notify(res)
 	}
 }
 
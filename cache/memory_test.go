@@ -2,6 +2,10 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -34,3 +38,354 @@ func TestCache(t *testing.T) {
 		t.Error("foo should not exist")
 	}
 }
+
+func TestGetOrLoad(t *testing.T) {
+	c := NewMemory(time.Minute, 0)
+	ctx := context.Background()
+
+	var calls int32
+	loader := func(ctx context.Context) (any, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return User{Name: "lingyin"}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var u User
+			if err := c.GetOrLoad(ctx, "user", &u, time.Minute, loader); err != nil {
+				t.Error(err)
+			} else if u.Name != "lingyin" {
+				t.Error("value not match")
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("loader called %d times", calls)
+	}
+
+	// 加载失败时不写入缓存
+	errLoad := errors.New("load failed")
+	var v string
+	err := c.GetOrLoad(ctx, "foo", &v, time.Minute, func(ctx context.Context) (any, error) {
+		return nil, errLoad
+	})
+	if !errors.Is(err, errLoad) {
+		t.Fatal(err)
+	}
+	if exists, _ := c.Exists(ctx, "foo"); exists {
+		t.Fatal("foo should not exist")
+	}
+
+	// 加载到 nil 时返回错误且不写入缓存, 之后的读取不受影响
+	err = c.GetOrLoad(ctx, "foo", &v, time.Minute, func(ctx context.Context) (any, error) {
+		return nil, nil
+	})
+	if !errors.Is(err, ErrNilValue) {
+		t.Fatalf("expected ErrNilValue, got %v", err)
+	}
+	if err = c.Scan(ctx, "foo", &v); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("nil value should not be cached, got %v", err)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	ctx := context.Background()
+	c := NewTyped[User](NewMemory(time.Minute, 0))
+
+	if _, err := c.Get(ctx, "user"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	u := User{Name: "lingyin"}
+	if err := c.Set(ctx, "user", u); err != nil {
+		t.Fatal(err)
+	}
+	u.Name = "changed"
+	got, err := c.Get(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "lingyin" {
+		t.Fatal("cached value should not be affected by the caller")
+	}
+
+	got, err = c.GetOrLoad(ctx, "user2", time.Minute, func(ctx context.Context) (User, error) {
+		return User{Name: "loaded"}, nil
+	})
+	if err != nil || got.Name != "loaded" {
+		t.Fatalf("unexpected result: %+v, %v", got, err)
+	}
+
+	users, err := c.MGet(ctx, "user", "user2", "user3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users["user2"].Name != "loaded" {
+		t.Fatalf("unexpected result: %+v", users)
+	}
+	if err = c.Remove(ctx, "user3"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBounded(t *testing.T) {
+	ctx := context.Background()
+	reasons := make(map[string]EvictReason)
+	onEvict := OnEvict(func(key string, value any, reason EvictReason) {
+		reasons[key] = reason
+	})
+
+	// LRU: 访问过的 a 保留, 淘汰最久未访问的 b
+	c := NewMemory(0, 0, MaxEntries(2), onEvict)
+	_ = c.Set(ctx, "a", 1)
+	_ = c.Set(ctx, "b", 2)
+	var v int
+	_ = c.Scan(ctx, "a", &v)
+	_ = c.Set(ctx, "c", 3)
+	if err := c.Scan(ctx, "b", &v); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("b should be evicted")
+	}
+	if reasons["b"] != EvictCapacity {
+		t.Fatalf("unexpected reason: %v", reasons["b"])
+	}
+
+	// LFU: 访问次数最少的 b 被淘汰
+	c = NewMemory(0, 0, MaxEntries(2), Eviction(LFU))
+	_ = c.Set(ctx, "a", 1)
+	_ = c.Set(ctx, "b", 2)
+	_ = c.Scan(ctx, "a", &v)
+	_ = c.Scan(ctx, "a", &v)
+	_ = c.Scan(ctx, "b", &v)
+	_ = c.Set(ctx, "c", 3)
+	if exists, _ := c.Exists(ctx, "b"); exists {
+		t.Fatal("b should be evicted")
+	}
+	if exists, _ := c.Exists(ctx, "a"); !exists {
+		t.Fatal("a should exist")
+	}
+
+	// LFU 访问次数定期减半, 过去的热点 a 会被新的热点 b 取代
+	c = NewMemory(0, 0, MaxEntries(2), Eviction(LFU))
+	_ = c.Set(ctx, "a", 1)
+	for i := 0; i < 1000; i++ {
+		_ = c.Scan(ctx, "a", &v)
+	}
+	_ = c.Set(ctx, "b", 2)
+	for i := 0; i < 300; i++ {
+		_ = c.Scan(ctx, "b", &v)
+	}
+	_ = c.Set(ctx, "c", 3)
+	if exists, _ := c.Exists(ctx, "a"); exists {
+		t.Fatal("a should be evicted after aging")
+	}
+	if exists, _ := c.Exists(ctx, "b"); !exists {
+		t.Fatal("b should exist")
+	}
+
+	// 限制容量时读取只加读锁
+	c = NewMemory(0, 0, MaxEntries(2))
+	_ = c.Set(ctx, "a", 1)
+	c.(*Memory).mu.RLock()
+	done := make(chan struct{})
+	go func() {
+		_ = c.Scan(ctx, "a", &v)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scan should not wait for the read lock")
+	}
+	c.(*Memory).mu.RUnlock()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				var n int
+				_ = c.Scan(ctx, "a", &n)
+				_ = c.Set(ctx, strconv.Itoa(j%4), j)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(c.(*Memory).elements); n > 2 {
+		t.Fatalf("entries should be bounded, got %d", n)
+	}
+
+	// 按大小限制
+	c = NewMemory(0, 0, MaxBytes(100), SizeFunc(func(key string, value any) int64 {
+		return int64(len(value.(string)))
+	}))
+	_ = c.Set(ctx, "a", string(make([]byte, 60)))
+	_ = c.Set(ctx, "b", string(make([]byte, 60)))
+	if exists, _ := c.Exists(ctx, "a"); exists {
+		t.Fatal("a should be evicted")
+	}
+
+	// 写入时清理过期元素
+	c = NewMemory(0, 0, onEvict)
+	_ = c.SetWithTTL(ctx, "d", 1, time.Millisecond)
+	_ = c.Set(ctx, "e", 1)
+	time.Sleep(5 * time.Millisecond)
+	_ = c.Set(ctx, "e", 2)
+	if reasons["d"] != EvictExpired || reasons["e"] != EvictReplaced {
+		t.Fatalf("unexpected reasons: %v", reasons)
+	}
+	if len(c.(*Memory).elements) != 1 {
+		t.Fatal("expired element should be removed")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range map[string]Cache{
+		"memory":  NewMemory(time.Minute, 0),
+		"sharded": NewSharded(4, time.Minute, 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := c.MSet(ctx, map[string]any{"a": "1", "b": "2", "c": "3"}, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = c.MRemove(ctx, "c", "d"); err != nil {
+				t.Fatal(err)
+			}
+			items, err := c.MGet(ctx, "a", "b", "c")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 3 || !items[0].Found || !items[1].Found || items[2].Found {
+				t.Fatalf("unexpected items: %+v", items)
+			}
+			var v string
+			if err = items[1].Scan(&v); err != nil || v != "2" {
+				t.Fatalf("unexpected value: %s, %v", v, err)
+			}
+			if err = items[2].Scan(&v); !errors.Is(err, ErrKeyNotFound) {
+				t.Fatal("c should not exist")
+			}
+		})
+	}
+}
+
+func TestNonPositiveTTL(t *testing.T) {
+	for name, c := range map[string]Cache{
+		"memory":  NewMemory(time.Minute, 0),
+		"sharded": NewSharded(4, time.Minute, 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			testNonPositiveTTL(t, c)
+		})
+	}
+}
+
+// testNonPositiveTTL ttl 小于等于 0 时写入的值不过期, 不保留原有的过期时间
+func testNonPositiveTTL(t *testing.T, c Cache) {
+	ctx := context.Background()
+	for _, ttl := range []time.Duration{0, InfiniteTTL, -time.Second} {
+		if err := c.SetWithTTL(ctx, "ttl", "v", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetWithTTL(ctx, "ttl", "v", ttl); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := c.TTL(ctx, "ttl"); err != nil || got != InfiniteTTL {
+			t.Fatalf("SetWithTTL(%v): ttl should be infinite, got %v, %v", ttl, got, err)
+		}
+
+		if err := c.MSet(ctx, map[string]any{"ttl": "v"}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.MSet(ctx, map[string]any{"ttl": "v"}, ttl); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := c.TTL(ctx, "ttl"); err != nil || got != InfiniteTTL {
+			t.Fatalf("MSet(%v): ttl should be infinite, got %v, %v", ttl, got, err)
+		}
+	}
+	_ = c.Remove(ctx, "ttl")
+}
+
+func TestCounter(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(0, 0)
+
+	if n, err := c.Incr(ctx, "views", time.Minute); err != nil || n != 1 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	if n, err := c.IncrBy(ctx, "views", 10, time.Hour); err != nil || n != 11 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	if n, err := c.Decr(ctx, "views", 0); err != nil || n != 10 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	// 只在创建时设置过期时间
+	ttl, err := c.TTL(ctx, "views")
+	if err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("unexpected ttl: %s, %v", ttl, err)
+	}
+
+	if err = c.Persist(ctx, "views"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _ = c.TTL(ctx, "views"); ttl != InfiniteTTL {
+		t.Fatalf("unexpected ttl: %s", ttl)
+	}
+	if err = c.Expire(ctx, "views", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err = c.TTL(ctx, "views"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("views should be expired")
+	}
+	if err = c.Expire(ctx, "views", time.Minute); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("views should not exist")
+	}
+
+	_ = c.Set(ctx, "name", "lingyin")
+	if _, err = c.Incr(ctx, "name", 0); !errors.Is(err, ErrNotInteger) {
+		t.Fatal("expected ErrNotInteger")
+	}
+	_ = c.Set(ctx, "count", 5)
+	if n, _ := c.Incr(ctx, "count", 0); n != 6 {
+		t.Fatalf("unexpected result: %d", n)
+	}
+	// 保留 Set 写入时的类型
+	var count int
+	if err = c.Scan(ctx, "count", &count); err != nil || count != 6 {
+		t.Fatalf("unexpected count: %d, %v", count, err)
+	}
+	_ = c.Set(ctx, "small", uint8(255))
+	if _, err = c.Incr(ctx, "small", 0); err == nil {
+		t.Fatal("expected overflow")
+	}
+}
+
+// BenchmarkBoundedGetParallel 并发读取有容量限制的缓存, 访问记录不应使读取串行化
+func BenchmarkBoundedGetParallel(b *testing.B) {
+	for name, p := range map[string]EvictionPolicy{"LRU": LRU, "LFU": LFU} {
+		b.Run(name, func(b *testing.B) {
+			c := NewMemory(time.Minute, 0, MaxEntries(1024), Eviction(p))
+			ctx := context.Background()
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = strconv.Itoa(i)
+				_ = c.Set(ctx, keys[i], i)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var v int
+				i := 0
+				for pb.Next() {
+					_ = c.Scan(ctx, keys[i&1023], &v)
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"container/list"
+	"reflect"
+)
+
+// EvictionPolicy 超出容量时的淘汰策略
+type EvictionPolicy int
+
+const (
+	// LRU 淘汰最久未访问的元素
+	LRU EvictionPolicy = iota
+	// LFU 淘汰访问次数最少的元素, 次数相同时淘汰最久未访问的, 适合热点稳定的场景.
+	// 访问次数会定期减半, 过去的热点不会一直占用缓存
+	LFU
+)
+
+const (
+	// lfuAgingFactor 访问次数达到元素数量的该倍数后, 所有元素的访问次数减半
+	lfuAgingFactor = 10
+	// lfuAgingMin 元素较少时的最小减半间隔
+	lfuAgingMin = 128
+)
+
+// policy 淘汰策略, 所有操作均为 O(1), 调用方需持有写锁
+type policy interface {
+	add(e *Element)
+	access(e *Element)
+	remove(e *Element)
+	// victim 返回下一个被淘汰的元素
+	victim() *Element
+}
+
+func newPolicy(p EvictionPolicy) policy {
+	if p == LFU {
+		return &lfu{freqs: list.New()}
+	}
+	return &lru{items: list.New()}
+}
+
+// lru 链表头部为最近访问的元素
+type lru struct {
+	items *list.List
+}
+
+func (p *lru) add(e *Element) {
+	e.node = p.items.PushFront(e)
+}
+
+func (p *lru) access(e *Element) {
+	p.items.MoveToFront(e.node.(*list.Element))
+}
+
+func (p *lru) remove(e *Element) {
+	p.items.Remove(e.node.(*list.Element))
+	e.node = nil
+}
+
+func (p *lru) victim() *Element {
+	if back := p.items.Back(); back != nil {
+		return back.Value.(*Element)
+	}
+	return nil
+}
+
+// lfu 按访问次数升序排列的频率链表, 每个频率节点下挂载该次数的元素
+type lfu struct {
+	freqs    *list.List
+	size     int
+	accesses int // 上次减半后的访问次数
+}
+
+type freqNode struct {
+	count int
+	items *list.List
+}
+
+type lfuNode struct {
+	freq *list.Element // 所在的频率节点
+	item *list.Element // 在频率节点中的位置
+}
+
+func (p *lfu) add(e *Element) {
+	front := p.freqs.Front()
+	if front == nil || front.Value.(*freqNode).count != 1 {
+		front = p.freqs.PushFront(&freqNode{count: 1, items: list.New()})
+	}
+	e.node = &lfuNode{freq: front, item: front.Value.(*freqNode).items.PushBack(e)}
+	p.size++
+}
+
+func (p *lfu) access(e *Element) {
+	p.accesses++
+	if p.accesses >= max(p.size*lfuAgingFactor, lfuAgingMin) {
+		p.age()
+	}
+
+	n := e.node.(*lfuNode)
+	cur := n.freq.Value.(*freqNode)
+	next := n.freq.Next()
+	if next == nil || next.Value.(*freqNode).count != cur.count+1 {
+		next = p.freqs.InsertAfter(&freqNode{count: cur.count + 1, items: list.New()}, n.freq)
+	}
+	cur.items.Remove(n.item)
+	if cur.items.Len() == 0 {
+		p.freqs.Remove(n.freq)
+	}
+	n.freq = next
+	n.item = next.Value.(*freqNode).items.PushBack(e)
+}
+
+func (p *lfu) remove(e *Element) {
+	n := e.node.(*lfuNode)
+	cur := n.freq.Value.(*freqNode)
+	cur.items.Remove(n.item)
+	if cur.items.Len() == 0 {
+		p.freqs.Remove(n.freq)
+	}
+	e.node = nil
+	p.size--
+}
+
+// age 所有访问次数减半(至少为 1), 减半后次数相同的节点合并, 原次数较少的元素排在前面先被淘汰
+func (p *lfu) age() {
+	p.accesses = 0
+	var prev *list.Element
+	for f := p.freqs.Front(); f != nil; {
+		next := f.Next()
+		cur := f.Value.(*freqNode)
+		cur.count = max(cur.count/2, 1)
+		if prev == nil || prev.Value.(*freqNode).count != cur.count {
+			prev = f
+			f = next
+			continue
+		}
+		target := prev.Value.(*freqNode)
+		for item := cur.items.Front(); item != nil; item = item.Next() {
+			e := item.Value.(*Element)
+			n := e.node.(*lfuNode)
+			n.freq = prev
+			n.item = target.items.PushBack(e)
+		}
+		p.freqs.Remove(f)
+		f = next
+	}
+}
+
+func (p *lfu) victim() *Element {
+	if front := p.freqs.Front(); front != nil {
+		return front.Value.(*freqNode).items.Front().Value.(*Element)
+	}
+	return nil
+}
+
+// expiryHeap 按到期时间排序的最小堆, 实现 heap.Interface
+type expiryHeap []*Element
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiry < h[j].expiry }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	e := x.(*Element)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// approxSize 粗略估算元素占用的字节数, 只统计字符串、切片和 map 的内容
+func approxSize(key string, value any) int64 {
+	return int64(len(key)) + sizeOf(reflect.ValueOf(value), 0)
+}
+
+func sizeOf(v reflect.Value, depth int) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	size := int64(v.Type().Size())
+	// 避免循环引用及过深的结构
+	if depth > 8 {
+		return size
+	}
+	switch v.Kind() {
+	case reflect.String:
+		size += int64(v.Len())
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			size += sizeOf(v.Elem(), depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			size += int64(v.Cap()) * int64(v.Type().Elem().Size())
+		}
+		if k := v.Type().Elem().Kind(); k == reflect.String || k == reflect.Pointer || k == reflect.Interface ||
+			k == reflect.Slice || k == reflect.Map || k == reflect.Struct {
+			for i := 0; i < v.Len(); i++ {
+				size += sizeOf(v.Index(i), depth+1) - int64(v.Type().Elem().Size())
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOf(iter.Key(), depth+1) + sizeOf(iter.Value(), depth+1)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOf(v.Field(i), depth+1) - int64(v.Field(i).Type().Size())
+		}
+	}
+	return size
+}
@@ -2,25 +2,105 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+	"strings"
 	"time"
 )
 
+const (
+	lockSuffix       = ":lock"
+	lockPollInterval = 50 * time.Millisecond
+)
+
+// unlockScript 只释放自己持有的锁
+var unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// incrScript 仅在创建计数器时设置过期时间
+var incrScript = redis.NewScript(`
+local created = redis.call("exists", KEYS[1]) == 0
+local v = redis.call("incrby", KEYS[1], ARGV[1])
+if created then
+	redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return v`)
+
 type Redis struct {
-	client *redis.Client
-	ttl    time.Duration
+	client  redis.UniversalClient
+	ttl     time.Duration
+	lockTTL time.Duration
+	group   singleflight.Group
+
+	codec      Codec
+	compressor Compressor
+	threshold  int
 }
 
-func NewRedis(url string, ttl time.Duration) Cache {
-	opt, err := redis.ParseURL(url)
+type RedisOption interface {
+	apply(*Redis)
+}
+
+type redisOptionFunc func(*Redis)
+
+func (f redisOptionFunc) apply(r *Redis) {
+	f(r)
+}
+
+// LoadLock GetOrLoad 加载数据前先获取分布式锁, 多个实例中只有一个执行 loader, ttl 为锁的过期时间
+func LoadLock(ttl time.Duration) RedisOption {
+	return redisOptionFunc(func(r *Redis) {
+		r.lockTTL = ttl
+	})
+}
+
+// NewRedis 单节点 Redis, url 格式错误时 panic
+func NewRedis(url string, ttl time.Duration, opts ...RedisOption) Cache {
+	r, err := NewRedisURL(url, ttl, opts...)
 	if err != nil {
 		panic(err)
 	}
-	return &Redis{
-		client: redis.NewClient(opt),
+	return r
+}
+
+// NewRedisURL 与 NewRedis 相同, url 格式错误时返回错误
+func NewRedisURL(url string, ttl time.Duration, opts ...RedisOption) (*Redis, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return WrapRedis(redis.NewClient(opt), ttl, opts...), nil
+}
+
+// NewRedisUniversal 根据 UniversalOptions 创建客户端:
+// 设置 MasterName 时为哨兵模式, 多个地址时为集群模式, 否则为单节点
+func NewRedisUniversal(opt *redis.UniversalOptions, ttl time.Duration, opts ...RedisOption) (*Redis, error) {
+	if opt == nil || len(opt.Addrs) == 0 {
+		return nil, errors.New("cache: redis addrs is empty")
+	}
+	return WrapRedis(redis.NewUniversalClient(opt), ttl, opts...), nil
+}
+
+// WrapRedis 使用已有的客户端, 可以是 *redis.Client、*redis.ClusterClient 或 *redis.Ring
+func WrapRedis(client redis.UniversalClient, ttl time.Duration, opts ...RedisOption) *Redis {
+	r := &Redis{
+		client: client,
 		ttl:    ttl,
 	}
+	for _, o := range opts {
+		o.apply(r)
+	}
+	return r
+}
+
+// Client 返回底层的客户端, 用于执行缓存接口之外的命令
+func (r *Redis) Client() redis.UniversalClient {
+	return r.client
 }
 
 func (r *Redis) Set(ctx context.Context, key string, value any) error {
@@ -28,11 +108,19 @@ func (r *Redis) Set(ctx context.Context, key string, value any) error {
 }
 
 func (r *Redis) SetWithTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
-	v, err := json.Marshal(value)
+	v, err := r.encode(value)
 	if err != nil {
 		return err
 	}
-	return r.client.Set(ctx, key, v, ttl).Err()
+	return r.client.Set(ctx, key, v, redisTTL(ttl)).Err()
+}
+
+// redisTTL 小于等于 0 表示不过期, go-redis 中 -1 表示 KEEPTTL, 统一转换为 0
+func redisTTL(ttl time.Duration) time.Duration {
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
 }
 
 func (r *Redis) Exists(ctx context.Context, key string) (bool, error) {
@@ -41,17 +129,153 @@ func (r *Redis) Exists(ctx context.Context, key string) (bool, error) {
 }
 
 func (r *Redis) Remove(ctx context.Context, key string) error {
-	exists, err := r.Exists(ctx, key)
+	n, err := r.client.Del(ctx, key).Result()
 	if err != nil {
 		return err
 	}
-	if !exists {
+	if n == 0 {
 		return ErrKeyNotFound
 	}
-	return r.client.Del(ctx, key).Err()
+	return nil
 }
 
 func (r *Redis) Scan(ctx context.Context, key string, value any) error {
+	v, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrKeyNotFound
+	} else if err != nil {
+		return err
+	}
+	return r.decode(v, value)
+}
+
+// MGet 使用 pipeline 逐个 GET, 集群模式下 key 可以分布在不同的 slot
+func (r *Redis) MGet(ctx context.Context, keys ...string) ([]Item, error) {
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = p.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	items := make([]Item, len(keys))
+	for i, cmd := range cmds {
+		items[i].Key = keys[i]
+		v, err := cmd.Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		items[i].Found = true
+		items[i].value = rawValue{data: v, decode: r.decode}
+	}
+	return items, nil
+}
+
+func (r *Redis) MSet(ctx context.Context, values map[string]any, ttl time.Duration) error {
+	data := make(map[string][]byte, len(values))
+	for key, value := range values {
+		v, err := r.encode(value)
+		if err != nil {
+			return err
+		}
+		data[key] = v
+	}
+	return r.mset(ctx, data, ttl)
+}
+
+// mset 写入已编码的数据
+func (r *Redis) mset(ctx context.Context, data map[string][]byte, ttl time.Duration) error {
+	ttl = redisTTL(ttl)
+	_, err := r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for key, v := range data {
+			p.Set(ctx, key, v, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) MRemove(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := r.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, key := range keys {
+			p.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var n int64
+	var err error
+	if ttl <= 0 {
+		n, err = r.client.IncrBy(ctx, key, delta).Result()
+	} else {
+		n, err = incrScript.Run(ctx, r.client, []string{key}, delta, ttl.Milliseconds()).Int64()
+	}
+	// 与内存缓存一致, 值不是整数时返回 ErrNotInteger
+	if err != nil && strings.Contains(err.Error(), "not an integer") {
+		return 0, ErrNotInteger
+	}
+	return n, err
+}
+
+func (r *Redis) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return r.IncrBy(ctx, key, 1, ttl)
+}
+
+func (r *Redis) Decr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return r.IncrBy(ctx, key, -1, ttl)
+}
+
+func (r *Redis) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	switch ttl {
+	case -2:
+		return 0, ErrKeyNotFound
+	case -1:
+		return InfiniteTTL, nil
+	}
+	return ttl, nil
+}
+
+func (r *Redis) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	var ok bool
+	var err error
+	if ttl <= 0 {
+		var n int64
+		n, err = r.client.Del(ctx, key).Result()
+		ok = n > 0
+	} else {
+		ok, err = r.client.PExpire(ctx, key, ttl).Result()
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// Persist key 没有过期时间时 PERSIST 同样返回 0, 需要区分 key 是否存在
+func (r *Redis) Persist(ctx context.Context, key string) error {
+	ok, err := r.client.Persist(ctx, key).Result()
+	if err != nil || ok {
+		return err
+	}
 	exists, err := r.Exists(ctx, key)
 	if err != nil {
 		return err
@@ -59,9 +283,66 @@ func (r *Redis) Scan(ctx context.Context, key string, value any) error {
 	if !exists {
 		return ErrKeyNotFound
 	}
-	v, err := r.client.Get(ctx, key).Bytes()
+	return nil
+}
+
+func (r *Redis) GetOrLoad(ctx context.Context, key string, value any, ttl time.Duration, loader Loader) error {
+	err := r.Scan(ctx, key, value)
+	if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	v, err := loadOnce(ctx, &r.group, key, func(ctx context.Context) (any, error) {
+		if r.lockTTL > 0 {
+			return r.loadWithLock(ctx, key, ttl, loader)
+		}
+		return r.load(ctx, key, ttl, loader)
+	})
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(v, value)
+	return assign(value, v)
+}
+
+func (r *Redis) load(ctx context.Context, key string, ttl time.Duration, loader Loader) (any, error) {
+	v, err := loader.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return v, r.SetWithTTL(ctx, key, v, ttl)
+}
+
+// loadWithLock 获取锁失败时等待持有者写入缓存, 锁过期后仍未写入则自行加载
+func (r *Redis) loadWithLock(ctx context.Context, key string, ttl time.Duration, loader Loader) (any, error) {
+	lockKey := key + lockSuffix
+	token := uuid.NewString()
+	ok, err := r.client.SetNX(ctx, lockKey, token, r.lockTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		defer unlockScript.Run(context.WithoutCancel(ctx), r.client, []string{lockKey}, token)
+		// 获取锁之前其他实例可能刚刚写入
+		if v, err := r.client.Get(ctx, key).Bytes(); err == nil {
+			return rawValue{data: v, decode: r.decode}, nil
+		}
+		return r.load(ctx, key, ttl, loader)
+	}
+
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(r.lockTTL)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		v, err := r.client.Get(ctx, key).Bytes()
+		if err == nil {
+			return rawValue{data: v, decode: r.decode}, nil
+		} else if !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+	}
+	return r.load(ctx, key, ttl, loader)
 }
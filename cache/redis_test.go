@@ -2,6 +2,11 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -64,3 +69,219 @@ func TestRedis(t *testing.T) {
 		t.Fatal("key should not exists")
 	}
 }
+
+func TestRedisGetOrLoad(t *testing.T) {
+	url := "redis://:@192.168.7.251:6379/0"
+	ctx := context.Background()
+	a := NewRedis(url, 5*time.Second, LoadLock(time.Second))
+	b := NewRedis(url, 5*time.Second, LoadLock(time.Second))
+	_ = a.Remove(ctx, "user")
+
+	var calls int32
+	loader := func(ctx context.Context) (any, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(200 * time.Millisecond)
+		return User{Name: "lingyin"}, nil
+	}
+	var wg sync.WaitGroup
+	for _, c := range []Cache{a, b, a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var u User
+			if err := c.GetOrLoad(ctx, "user", &u, 5*time.Second, loader); err != nil {
+				t.Error(err)
+			} else if u.Name != "lingyin" {
+				t.Error("value not match")
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("loader called %d times", calls)
+	}
+}
+
+func TestTiered(t *testing.T) {
+	url := "redis://:@192.168.7.251:6379/0"
+	ctx := context.Background()
+	l2a, err := NewRedisURL(url, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2b, err := NewRedisURL(url, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewTiered(NewMemory(0, time.Minute), l2a, time.Second)
+	b := NewTiered(NewMemory(0, time.Minute), l2b, time.Second)
+
+	if err := a.Set(ctx, "user", User{Name: "lingyin"}); err != nil {
+		t.Fatal(err)
+	}
+	var u User
+	if err := b.Scan(ctx, "user", &u); err != nil || u.Name != "lingyin" {
+		t.Fatalf("unexpected value: %+v, %v", u, err)
+	}
+
+	// a 更新后 b 的 L1 被删除
+	if err := a.Set(ctx, "user", User{Name: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := b.Scan(ctx, "user", &u); err != nil || u.Name != "updated" {
+		t.Fatalf("unexpected value: %+v, %v", u, err)
+	}
+
+	if err := a.Remove(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := b.Scan(ctx, "user", &u); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("user should be removed, got %v", err)
+	}
+}
+
+func TestRedisCounter(t *testing.T) {
+	c := NewRedis("redis://:@192.168.7.251:6379/0", 5*time.Second)
+	ctx := context.Background()
+	_ = c.Remove(ctx, "views")
+
+	if n, err := c.Incr(ctx, "views", time.Minute); err != nil || n != 1 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	if n, err := c.IncrBy(ctx, "views", 10, time.Hour); err != nil || n != 11 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	ttl, err := c.TTL(ctx, "views")
+	if err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("unexpected ttl: %s, %v", ttl, err)
+	}
+	if err = c.Persist(ctx, "views"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _ = c.TTL(ctx, "views"); ttl != InfiniteTTL {
+		t.Fatalf("unexpected ttl: %s", ttl)
+	}
+	var n int64
+	if err = c.Scan(ctx, "views", &n); err != nil || n != 11 {
+		t.Fatalf("unexpected value: %d, %v", n, err)
+	}
+	if err = c.Expire(ctx, "views", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.TTL(ctx, "views"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal("views should be removed")
+	}
+
+	_ = c.Set(ctx, "name", "lingyin")
+	for _, ttl := range []time.Duration{0, time.Minute} {
+		if _, err = c.Incr(ctx, "name", ttl); !errors.Is(err, ErrNotInteger) {
+			t.Fatalf("expected ErrNotInteger, got %v", err)
+		}
+	}
+}
+
+func TestRedisTyped(t *testing.T) {
+	r, err := NewRedisURL("redis://:@192.168.7.251:6379/0", 5*time.Second, Encoding(Protobuf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewTyped[*wrapperspb.StringValue](r)
+	ctx := context.Background()
+	if err = c.Set(ctx, "typed", wrapperspb.String("bar")); err != nil {
+		t.Fatal(err)
+	}
+	v, err := c.Get(ctx, "typed")
+	if err != nil || v.GetValue() != "bar" {
+		t.Fatalf("unexpected value: %v, %v", v, err)
+	}
+	values, err := c.MGet(ctx, "typed")
+	if err != nil || values["typed"].GetValue() != "bar" {
+		t.Fatalf("unexpected values: %v, %v", values, err)
+	}
+}
+
+func TestNewRedisUniversal(t *testing.T) {
+	if _, err := NewRedisURL("invalid://", time.Second); err == nil {
+		t.Fatal("expected error for invalid url")
+	}
+	if _, err := NewRedisUniversal(&redis.UniversalOptions{}, time.Second); err == nil {
+		t.Fatal("expected error for empty addrs")
+	}
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:7000", "127.0.0.1:7001"}})
+	if r := WrapRedis(client, time.Second); r.Client() != client {
+		t.Fatal("client not match")
+	}
+}
+
+func TestRedisLocker(t *testing.T) {
+	r, err := NewRedisURL("redis://:@192.168.7.251:6379/0", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testLocker(t, NewRedisLocker(r))
+}
+
+func TestRedisNonPositiveTTL(t *testing.T) {
+	c, err := NewRedisURL("redis://:@192.168.7.251:6379/0", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testNonPositiveTTL(t, c)
+}
+
+// argsHook 记录发送的命令而不请求 Redis
+type argsHook struct {
+	args [][]any
+}
+
+func (h *argsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *argsHook) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		h.args = append(h.args, cmd.Args())
+		return nil
+	}
+}
+
+func (h *argsHook) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(_ context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			h.args = append(h.args, cmd.Args())
+		}
+		return nil
+	}
+}
+
+// TestRedisTTLArgs ttl 小于等于 0 时不能发送 KEEPTTL, 否则会保留原有的过期时间
+func TestRedisTTLArgs(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	hook := &argsHook{}
+	client.AddHook(hook)
+	c := WrapRedis(client, InfiniteTTL)
+
+	ctx := context.Background()
+	for _, ttl := range []time.Duration{0, InfiniteTTL, -time.Second} {
+		hook.args = nil
+		if err := c.SetWithTTL(ctx, "foo", "bar", ttl); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.MSet(ctx, map[string]any{"foo": "bar"}, ttl); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Set(ctx, "foo", "bar"); err != nil {
+			t.Fatal(err)
+		}
+		if len(hook.args) != 3 {
+			t.Fatalf("unexpected commands: %v", hook.args)
+		}
+		for _, args := range hook.args {
+			if len(args) != 3 {
+				t.Fatalf("ttl %v: set should not have options, got %v", ttl, args)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// Sharded 分片的内存缓存, 每个分片独立加锁及淘汰, 降低锁竞争
+type Sharded struct {
+	shards  []*cache
+	mask    uint64
+	hash    func(key string) uint64
+	evictor *Evictor
+}
+
+// NewSharded shards 会向上取整为 2 的幂, 小于等于 0 时按 CPU 数量确定;
+// MaxEntries 及 MaxBytes 为总量, 平均分配到各个分片
+func NewSharded(shards int, ttl time.Duration, evictInterval time.Duration, opts ...MemoryOption) Cache {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0) * 4
+	}
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+
+	s := &Sharded{
+		shards: make([]*cache, n),
+		mask:   uint64(n - 1),
+	}
+	for i := range s.shards {
+		c := newCache(ttl, 0, opts...)
+		if c.maxEntries > 0 {
+			c.maxEntries = (c.maxEntries + n - 1) / n
+		}
+		if c.maxBytes > 0 {
+			c.maxBytes = (c.maxBytes + int64(n) - 1) / int64(n)
+		}
+		s.shards[i] = c
+	}
+	s.hash = s.shards[0].hash
+	if s.hash == nil {
+		s.hash = fnv64a
+	}
+
+	if evictInterval > 0 {
+		s.evictor = newEvictor(evictInterval, s.shards...)
+		runtime.SetFinalizer(s, shutdownSharded)
+	}
+	return s
+}
+
+func (s *Sharded) Set(ctx context.Context, key string, value any) error {
+	return s.shard(key).Set(ctx, key, value)
+}
+
+func (s *Sharded) SetWithTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	return s.shard(key).SetWithTTL(ctx, key, value, ttl)
+}
+
+func (s *Sharded) Exists(ctx context.Context, key string) (bool, error) {
+	return s.shard(key).Exists(ctx, key)
+}
+
+func (s *Sharded) Remove(ctx context.Context, key string) error {
+	return s.shard(key).Remove(ctx, key)
+}
+
+func (s *Sharded) Scan(ctx context.Context, key string, value any) error {
+	return s.shard(key).Scan(ctx, key, value)
+}
+
+func (s *Sharded) GetOrLoad(ctx context.Context, key string, value any, ttl time.Duration, loader Loader) error {
+	return s.shard(key).GetOrLoad(ctx, key, value, ttl, loader)
+}
+
+// MGet 按分片分组, 每个分片只加一次锁
+func (s *Sharded) MGet(ctx context.Context, keys ...string) ([]Item, error) {
+	items := make([]Item, len(keys))
+	for shard, idx := range s.group(keys) {
+		now := time.Now().UnixNano()
+		unlock := shard.lockRead()
+		for _, i := range idx {
+			items[i].Key = keys[i]
+			items[i].value, items[i].Found = shard.lookup(keys[i], now)
+		}
+		unlock()
+	}
+	return items, nil
+}
+
+func (s *Sharded) MSet(ctx context.Context, values map[string]any, ttl time.Duration) error {
+	parts := make(map[*cache]map[string]any)
+	for key, value := range values {
+		shard := s.shard(key)
+		if parts[shard] == nil {
+			parts[shard] = make(map[string]any)
+		}
+		parts[shard][key] = value
+	}
+	for shard, part := range parts {
+		if err := shard.MSet(ctx, part, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sharded) MRemove(ctx context.Context, keys ...string) error {
+	for shard, idx := range s.group(keys) {
+		part := make([]string, len(idx))
+		for j, i := range idx {
+			part[j] = keys[i]
+		}
+		if err := shard.MRemove(ctx, part...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sharded) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return s.shard(key).IncrBy(ctx, key, delta, ttl)
+}
+
+func (s *Sharded) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return s.shard(key).Incr(ctx, key, ttl)
+}
+
+func (s *Sharded) Decr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return s.shard(key).Decr(ctx, key, ttl)
+}
+
+func (s *Sharded) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return s.shard(key).TTL(ctx, key)
+}
+
+func (s *Sharded) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return s.shard(key).Expire(ctx, key, ttl)
+}
+
+func (s *Sharded) Persist(ctx context.Context, key string) error {
+	return s.shard(key).Persist(ctx, key)
+}
+
+// group 按分片对 keys 的下标分组
+func (s *Sharded) group(keys []string) map[*cache][]int {
+	res := make(map[*cache][]int)
+	for i, key := range keys {
+		shard := s.shard(key)
+		res[shard] = append(res[shard], i)
+	}
+	return res
+}
+
+func (s *Sharded) shard(key string) *cache {
+	return s.shards[s.hash(key)&s.mask]
+}
+
+// fnv64a FNV-1a 哈希, 避免 hash.Hash 带来的内存分配
+func fnv64a(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func shutdownSharded(s *Sharded) {
+	s.evictor.stop <- true
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSharded(t *testing.T) {
+	ctx := context.Background()
+	c := NewSharded(6, time.Minute, 10*time.Millisecond, MaxEntries(800))
+	s := c.(*Sharded)
+	if len(s.shards) != 8 {
+		t.Fatalf("shards should be rounded up to 8, got %d", len(s.shards))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := strconv.Itoa(i*200 + j)
+				_ = c.Set(ctx, key, j)
+				var v int
+				if err := c.Scan(ctx, key, &v); err != nil && !errors.Is(err, ErrKeyNotFound) {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var total int
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		n := len(shard.elements)
+		shard.mu.RUnlock()
+		if n > shard.maxEntries {
+			t.Fatalf("shard exceeds max entries: %d", n)
+		}
+		total += n
+	}
+	if total > 800 {
+		t.Fatalf("too many entries: %d", total)
+	}
+
+	_ = c.SetWithTTL(ctx, "tmp", 1, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	// 过期元素由 Evictor 清理, 不依赖写入
+	shard := s.shard("tmp")
+	shard.mu.RLock()
+	_, ok := shard.elements["tmp"]
+	shard.mu.RUnlock()
+	if ok {
+		t.Fatal("tmp should be evicted")
+	}
+}
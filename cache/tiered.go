@@ -0,0 +1,284 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/dmzlingyin/utils/log"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TieredChannel 广播失效消息的 Redis 频道
+const TieredChannel = "cache:invalidate"
+
+// Tiered 两级缓存, 先读进程内的 L1 再读 Redis(L2), 写入及删除时通过 pub/sub 通知其他实例删除 L1.
+// 消息丢失(如断线)时其他实例的 L1 最多在 l1TTL 内读到旧值
+type Tiered struct {
+	l1     Cache
+	l2     *Redis
+	l1TTL  time.Duration
+	id     string
+	pubsub *redis.PubSub
+}
+
+// NewTiered l2 可由 NewRedisURL、NewRedisUniversal 或 WrapRedis 创建, l1 中保存 l2 编码后的数据, 与 Redis 语义一致
+func NewTiered(l1 Cache, l2 *Redis, l1TTL time.Duration) Cache {
+	t := &Tiered{
+		l1:     l1,
+		l2:     l2,
+		l1TTL:  l1TTL,
+		id:     uuid.NewString(),
+		pubsub: l2.client.Subscribe(context.Background(), TieredChannel),
+	}
+	go t.listen()
+	return t
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, value any) error {
+	return t.SetWithTTL(ctx, key, value, t.l2.ttl)
+}
+
+func (t *Tiered) SetWithTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	data, err := t.l2.encode(value)
+	if err != nil {
+		return err
+	}
+	if err = t.l2.client.Set(ctx, key, data, ttl).Err(); err != nil {
+		return err
+	}
+	if err = t.l1.SetWithTTL(ctx, key, data, t.localTTL(ttl)); err != nil {
+		return err
+	}
+	return t.publish(ctx, key)
+}
+
+func (t *Tiered) Exists(ctx context.Context, key string) (bool, error) {
+	if ok, err := t.l1.Exists(ctx, key); err != nil || ok {
+		return ok, err
+	}
+	return t.l2.Exists(ctx, key)
+}
+
+func (t *Tiered) Remove(ctx context.Context, key string) error {
+	if err := t.l1.Remove(ctx, key); err != nil {
+		return err
+	}
+	err := t.l2.Remove(ctx, key)
+	if e := t.publish(ctx, key); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+func (t *Tiered) Scan(ctx context.Context, key string, value any) error {
+	var data []byte
+	err := t.l1.Scan(ctx, key, &data)
+	if errors.Is(err, ErrKeyNotFound) {
+		data, err = t.load(ctx, key)
+	}
+	if err != nil {
+		return err
+	}
+	return t.l2.decode(data, value)
+}
+
+func (t *Tiered) GetOrLoad(ctx context.Context, key string, value any, ttl time.Duration, loader Loader) error {
+	var data []byte
+	err := t.l1.Scan(ctx, key, &data)
+	if err == nil {
+		return t.l2.decode(data, value)
+	} else if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	if err = t.l2.GetOrLoad(ctx, key, value, ttl, loader); err != nil {
+		return err
+	}
+	// 重新编码后写入 L1, 仅在 L1 未命中时执行. value 为指针, 编码其指向的值, 如 Protobuf 要求 proto.Message
+	if data, err = t.l2.encode(reflect.ValueOf(value).Elem().Interface()); err != nil {
+		return err
+	}
+	return t.l1.SetWithTTL(ctx, key, data, t.localTTL(ttl))
+}
+
+// MGet 先批量读取 L1, 未命中的再批量读取 L2 并写入 L1
+func (t *Tiered) MGet(ctx context.Context, keys ...string) ([]Item, error) {
+	items, err := t.l1.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	var misses []string
+	var idx []int
+	for i := range items {
+		if !items[i].Found {
+			misses = append(misses, keys[i])
+			idx = append(idx, i)
+		}
+	}
+	if len(misses) == 0 {
+		return t.toRaw(items), nil
+	}
+
+	loaded, err := t.l2.MGet(ctx, misses...)
+	if err != nil {
+		return nil, err
+	}
+	// 批量读取时不查询 L2 的剩余时间, 直接使用 l1TTL
+	values := make(map[string]any)
+	for j, item := range loaded {
+		if raw, ok := item.value.(rawValue); ok {
+			values[item.Key] = raw.data
+		}
+		items[idx[j]] = item
+	}
+	if err = t.l1.MSet(ctx, values, t.l1TTL); err != nil {
+		return nil, err
+	}
+	return t.toRaw(items), nil
+}
+
+func (t *Tiered) MSet(ctx context.Context, values map[string]any, ttl time.Duration) error {
+	data := make(map[string][]byte, len(values))
+	local := make(map[string]any, len(values))
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		v, err := t.l2.encode(value)
+		if err != nil {
+			return err
+		}
+		data[key] = v
+		local[key] = v
+		keys = append(keys, key)
+	}
+	if err := t.l2.mset(ctx, data, ttl); err != nil {
+		return err
+	}
+	if err := t.l1.MSet(ctx, local, t.localTTL(ttl)); err != nil {
+		return err
+	}
+	return t.publish(ctx, keys...)
+}
+
+func (t *Tiered) MRemove(ctx context.Context, keys ...string) error {
+	if err := t.l1.MRemove(ctx, keys...); err != nil {
+		return err
+	}
+	if err := t.l2.MRemove(ctx, keys...); err != nil {
+		return err
+	}
+	return t.publish(ctx, keys...)
+}
+
+// IncrBy 计数器以 L2 为准, 修改后删除各实例 L1 中的旧值
+func (t *Tiered) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	n, err := t.l2.IncrBy(ctx, key, delta, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return n, t.invalidate(ctx, key)
+}
+
+func (t *Tiered) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return t.IncrBy(ctx, key, 1, ttl)
+}
+
+func (t *Tiered) Decr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return t.IncrBy(ctx, key, -1, ttl)
+}
+
+func (t *Tiered) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return t.l2.TTL(ctx, key)
+}
+
+// Expire L1 中的过期时间可能超过新的 ttl, 需要删除
+func (t *Tiered) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	if err := t.l2.Expire(ctx, key, ttl); err != nil {
+		return err
+	}
+	return t.invalidate(ctx, key)
+}
+
+// Persist L1 始终受 l1TTL 限制, 无需处理
+func (t *Tiered) Persist(ctx context.Context, key string) error {
+	return t.l2.Persist(ctx, key)
+}
+
+func (t *Tiered) invalidate(ctx context.Context, key string) error {
+	if err := t.l1.Remove(ctx, key); err != nil {
+		return err
+	}
+	return t.publish(ctx, key)
+}
+
+// toRaw L1 中保存的是 l2 编码后的数据, 转换后 Item.Scan 与 Redis 语义一致
+func (t *Tiered) toRaw(items []Item) []Item {
+	for i := range items {
+		if data, ok := items[i].value.([]byte); ok {
+			items[i].value = rawValue{data: data, decode: t.l2.decode}
+		}
+	}
+	return items
+}
+
+// Close 取消订阅失效消息
+func (t *Tiered) Close() error {
+	return t.pubsub.Close()
+}
+
+// load 从 L2 读取并写入 L1, L1 的过期时间不超过 L2 的剩余时间
+func (t *Tiered) load(ctx context.Context, key string) ([]byte, error) {
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := t.l2.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		get = p.Get(ctx, key)
+		pttl = p.PTTL(ctx, key)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	data, err := get.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if err = t.l1.SetWithTTL(ctx, key, data, t.localTTL(pttl.Val())); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// localTTL L1 的过期时间取 ttl 与 l1TTL 的较小值, ttl 小于等于 0 表示不过期
+func (t *Tiered) localTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > t.l1TTL {
+		return t.l1TTL
+	}
+	return ttl
+}
+
+func (t *Tiered) publish(ctx context.Context, keys ...string) error {
+	_, err := t.l2.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, key := range keys {
+			p.Publish(ctx, TieredChannel, t.id+":"+key)
+		}
+		return nil
+	})
+	return err
+}
+
+func (t *Tiered) listen() {
+	for msg := range t.pubsub.Channel() {
+		id, key, ok := strings.Cut(msg.Payload, ":")
+		// 忽略本实例发出的消息
+		if !ok || id == t.id {
+			continue
+		}
+		if err := t.l1.Remove(context.Background(), key); err != nil {
+			log.Errorf("remove tiered cache key %s error: %s", key, err)
+		}
+	}
+}
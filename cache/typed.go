@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Typed 泛型缓存, Redis 及两级缓存使用配置的 Codec 编解码 T, 内存缓存以 JSON 保存,
+// 读取到的都是独立的副本, 语义一致
+type Typed[T any] struct {
+	c Cache
+	// native 后端自行编解码, 直接读写 T, 否则以 JSON 保存
+	native bool
+}
+
+func NewTyped[T any](c Cache) *Typed[T] {
+	t := &Typed[T]{c: c}
+	switch c.(type) {
+	case *Redis, *Tiered:
+		t.native = true
+	}
+	return t
+}
+
+// Get key 不存在或已过期时返回 ErrKeyNotFound
+func (t *Typed[T]) Get(ctx context.Context, key string) (T, error) {
+	var v T
+	if t.native {
+		if err := t.c.Scan(ctx, key, &v); err != nil {
+			var zero T
+			return zero, err
+		}
+		return v, nil
+	}
+	var raw json.RawMessage
+	if err := t.c.Scan(ctx, key, &raw); err != nil {
+		return v, err
+	}
+	return decode[T](raw)
+}
+
+func (t *Typed[T]) Set(ctx context.Context, key string, value T) error {
+	v, err := t.encode(value)
+	if err != nil {
+		return err
+	}
+	return t.c.Set(ctx, key, v)
+}
+
+func (t *Typed[T]) SetWithTTL(ctx context.Context, key string, value T, ttl time.Duration) error {
+	v, err := t.encode(value)
+	if err != nil {
+		return err
+	}
+	return t.c.SetWithTTL(ctx, key, v, ttl)
+}
+
+// Remove key 不存在时不返回错误
+func (t *Typed[T]) Remove(ctx context.Context, key string) error {
+	if err := t.c.Remove(ctx, key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (t *Typed[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	load := func(ctx context.Context) (any, error) {
+		v, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return t.encode(v)
+	}
+	var v T
+	if t.native {
+		if err := t.c.GetOrLoad(ctx, key, &v, ttl, load); err != nil {
+			var zero T
+			return zero, err
+		}
+		return v, nil
+	}
+	var raw json.RawMessage
+	if err := t.c.GetOrLoad(ctx, key, &raw, ttl, load); err != nil {
+		return v, err
+	}
+	return decode[T](raw)
+}
+
+// MGet 批量读取, 结果中不包含不存在的 key
+func (t *Typed[T]) MGet(ctx context.Context, keys ...string) (map[string]T, error) {
+	items, err := t.c.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]T, len(items))
+	for _, item := range items {
+		if !item.Found {
+			continue
+		}
+		if t.native {
+			var v T
+			if err = item.Scan(&v); err != nil {
+				return nil, err
+			}
+			res[item.Key] = v
+			continue
+		}
+		var raw json.RawMessage
+		if err = item.Scan(&raw); err != nil {
+			return nil, err
+		}
+		if res[item.Key], err = decode[T](raw); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// encode 内存缓存中保存 JSON, 避免调用方修改读取到的值影响缓存
+func (t *Typed[T]) encode(v T) (any, error) {
+	if t.native {
+		return v, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(raw), nil
+}
+
+func decode[T any](raw json.RawMessage) (T, error) {
+	var v T
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
@@ -3,6 +3,7 @@ package log_test
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/dmzlingyin/utils/log"
@@ -16,7 +17,7 @@ func TestLog(t *testing.T) {
 }
 
 func TestNewLogger(t *testing.T) {
-	file, err := os.OpenFile("log.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	file, err := os.OpenFile(filepath.Join(t.TempDir(), "log.txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,116 @@
+package oauth2
+
+import (
+	"context"
+	"github.com/dmzlingyin/utils/config"
+	"github.com/smartwalle/alipay/v3"
+	"golang.org/x/oauth2"
+	"net/url"
+	"time"
+)
+
+const (
+	AlipayAuthURL           = "https://openauth.alipay.com/oauth2/publicAppAuthorize.htm"
+	AlipaySandboxAuthURL    = "https://openauth.alipaydev.com/oauth2/publicAppAuthorize.htm"
+	AlipayGatewayURL        = "https://openapi.alipay.com/gateway.do"
+	AlipaySandboxGatewayURL = "https://openapi-sandbox.dl.alipaydev.com/gateway.do"
+)
+
+const AlipayScopeUser = "auth_user"
+
+func NewAlipay() Provider {
+	return must(NewAlipayWith(
+		ClientID(config.GetString("oauth2.alipay.app_id")),
+		ClientSecret(config.GetString("oauth2.alipay.private_key")),
+		AlipayPublicKey(config.GetString("oauth2.alipay.public_key"), config.GetBool("oauth2.alipay.is_production")),
+		RedirectURL(config.GetString("oauth2.alipay.redirect_url")),
+	))
+}
+
+// NewAlipayWith ClientSecret 为应用私钥
+func NewAlipayWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts)
+	def := Endpoints{AuthURL: AlipaySandboxAuthURL, APIURL: AlipaySandboxGatewayURL}
+	if o.production {
+		def = Endpoints{AuthURL: AlipayAuthURL, APIURL: AlipayGatewayURL}
+	}
+	ep := o.resolveEndpoints(def)
+	// 只有与 production 对应的网关设置会生效
+	client, err := alipay.New(o.clientID, o.clientSecret, o.production,
+		alipay.WithProductionGateway(ep.APIURL),
+		alipay.WithSandboxGateway(ep.APIURL),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = client.LoadAliPayPublicKey(o.alipayPublicKey); err != nil {
+		return nil, err
+	}
+	return &alipayAuth{
+		client:      client,
+		appID:       o.clientID,
+		authURL:     ep.AuthURL,
+		redirectURL: o.redirectURL,
+	}, nil
+}
+
+type alipayAuth struct {
+	client      *alipay.Client
+	appID       string
+	authURL     string
+	redirectURL string
+}
+
+// AuthCodeURL 与 alipay.PublicAppAuthorize 相同, 但授权页面地址可以覆盖
+func (a *alipayAuth) AuthCodeURL(state, _, redirect string) string {
+	if redirect == "" {
+		redirect = a.redirectURL
+	}
+	q := url.Values{}
+	q.Set("app_id", a.appID)
+	q.Set("scope", AlipayScopeUser)
+	q.Set("redirect_uri", redirect)
+	if state != "" {
+		q.Set("state", state)
+	}
+	return a.authURL + "?" + q.Encode()
+}
+
+func (a *alipayAuth) Authorize(ctx context.Context, args *AuthArgs) (*oauth2.Token, *User, error) {
+	rsp, err := a.client.SystemOauthToken(ctx, alipay.SystemOauthToken{
+		GrantType: "authorization_code",
+		Code:      args.Code,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if rsp.IsFailure() {
+		return nil, nil, rsp.Error
+	}
+	token := &oauth2.Token{
+		AccessToken:  rsp.AccessToken,
+		RefreshToken: rsp.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(rsp.ExpiresIn) * time.Second),
+	}
+
+	info, err := a.client.UserInfoShare(ctx, alipay.UserInfoShare{AuthToken: rsp.AccessToken})
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsFailure() {
+		return nil, nil, info.Error
+	}
+
+	// 新创建的应用只返回 open_id
+	id := rsp.OpenId
+	if id == "" {
+		id = rsp.UserId
+	}
+	return token, &User{
+		ID:       id,
+		Username: info.NickName,
+		Avatar:   info.Avatar,
+		Phone:    info.Mobile,
+		UnionID:  rsp.UnionId,
+	}, nil
+}
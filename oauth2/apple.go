@@ -14,7 +14,6 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"time"
 )
@@ -28,8 +27,11 @@ type AppleConfig struct {
 }
 
 const (
-	AppleTokenURL = "https://appleid.apple.com/auth/token"
-	AppleKeyURL   = "https://appleid.apple.com/auth/keys"
+	AppleAuthURL   = "https://appleid.apple.com/auth/authorize"
+	AppleTokenURL  = "https://appleid.apple.com/auth/token"
+	AppleRevokeURL = "https://appleid.apple.com/auth/revoke"
+	AppleKeyURL    = "https://appleid.apple.com/auth/keys"
+	AppleIssuer    = "https://appleid.apple.com"
 )
 
 type JwtKeys struct {
@@ -42,31 +44,75 @@ type JwtKeys struct {
 }
 
 func NewApple() Provider {
+	opts := append(configOptions("oauth2.apple"),
+		AppleKey(config.GetString("oauth2.apple.team_id"), config.GetString("oauth2.apple.key_id"), configFile("oauth2.apple.key_path")))
+	return must(NewAppleWith(opts...))
+}
+
+// NewAppleWith 同一进程中可以为不同的 services id 创建多个实例
+func NewAppleWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts)
+	if len(o.privateKey) == 0 {
+		return nil, errors.New("the private key of apple is empty")
+	}
 	cfg := &AppleConfig{
-		keyId:       config.GetString("oauth2.apple.key_id"),
-		teamId:      config.GetString("oauth2.apple.team_id"),
-		clientId:    config.GetString("oauth2.apple.client_id"),
-		redirectUrl: config.GetString("oauth2.apple.redirect_url"),
+		secret:      o.privateKey,
+		keyId:       o.keyID,
+		teamId:      o.teamID,
+		clientId:    o.clientID,
+		redirectUrl: o.redirectURL,
 	}
-	file, err := os.ReadFile("config/key.pem")
-	if err != nil {
-		panic(err)
+	a := &apple{
+		cfg: cfg,
+		ep: o.resolveEndpoints(Endpoints{
+			AuthURL:   AppleAuthURL,
+			TokenURL:  AppleTokenURL,
+			KeyURL:    AppleKeyURL,
+			RevokeURL: AppleRevokeURL,
+			Issuer:    AppleIssuer,
+		}),
 	}
-	cfg.secret = file
-	return &apple{
-		cfg:     cfg,
-		decoder: mjwt.NewDecoder(AppleKeyURL),
+	if _, err := a.authKeyFromBytes(cfg.secret); err != nil {
+		return nil, err
 	}
+	// 原生登录的受众为 bundle id, 网页登录为 services id
+	audiences := append([]string{cfg.clientId}, o.audiences...)
+	a.decoder = mjwt.NewDecoder(a.ep.KeyURL, mjwt.Issuers(a.ep.Issuer), mjwt.Audiences(audiences...))
+	return a, nil
 }
 
 type apple struct {
 	cfg     *AppleConfig
+	ep      Endpoints
 	decoder *mjwt.Decoder
 }
 
-func (a *apple) Authorize(_ context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
+// AuthCodeURL 苹果不支持 PKCE, 请求姓名和邮箱时回调只能是 form_post
+func (a *apple) AuthCodeURL(state, _, redirect string) string {
+	if redirect == "" {
+		redirect = a.cfg.redirectUrl
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("response_mode", "form_post")
+	q.Set("client_id", a.cfg.clientId)
+	q.Set("redirect_uri", redirect)
+	q.Set("scope", "name email")
+	q.Set("state", state)
+	return a.ep.AuthURL + "?" + q.Encode()
+}
+
+func (a *apple) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
+	if args.Token != "" {
+		return verifyIDToken(a.decoder, args.Token, args.Nonce)
+	}
+
+	redirect := args.RedirectURL
+	if redirect == "" {
+		redirect = a.cfg.redirectUrl
+	}
 	var idToken string
-	token, idToken, err = a.getToken(args.Code)
+	token, idToken, err = a.getToken(ctx, args.Code, redirect)
 	if err != nil {
 		return
 	}
@@ -76,22 +122,69 @@ func (a *apple) Authorize(_ context.Context, args *AuthArgs) (token *oauth2.Toke
 		return
 	}
 	user = &User{
-		ID:       claims.Subject,
-		Username: claims.Name,
-		Avatar:   claims.Picture,
-		Email:    claims.Email,
+		ID:            claims.Subject,
+		Username:      claims.Name,
+		Avatar:        claims.Picture,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
 	}
 	return
 }
 
-func (a *apple) getToken(code string) (token *oauth2.Token, IDToken string, err error) {
-	data, err := a.httpRequest("POST", AppleTokenURL, map[string]string{
+// Refresh 苹果刷新时不会返回新的 refresh token
+func (a *apple) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	token, idToken, err := a.requestToken(ctx, map[string]string{
+		"client_id":     a.cfg.clientId,
+		"client_secret": a.getAppleSecret(),
+		"grant_type":    "refresh_token",
+		"refresh_token": refreshToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	token.RefreshToken = refreshToken
+	return token.WithExtra(map[string]any{"id_token": idToken}), nil
+}
+
+// Revoke 撤销 refresh token 或 access token, App Store 要求注销账号时必须调用
+func (a *apple) Revoke(ctx context.Context, token string) error {
+	data, err := a.httpRequest(ctx, "POST", a.ep.RevokeURL, map[string]string{
+		"client_id":     a.cfg.clientId,
+		"client_secret": a.getAppleSecret(),
+		"token":         token,
+	})
+	if err != nil {
+		return err
+	}
+	// 成功时返回空内容
+	if len(data) == 0 {
+		return nil
+	}
+	var res struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+	if res.Error != "" {
+		return errors.New(res.Error + ": " + res.ErrorDescription)
+	}
+	return nil
+}
+
+func (a *apple) getToken(ctx context.Context, code, redirect string) (token *oauth2.Token, IDToken string, err error) {
+	return a.requestToken(ctx, map[string]string{
 		"client_id":     a.cfg.clientId,
 		"client_secret": a.getAppleSecret(),
 		"code":          code,
 		"grant_type":    "authorization_code",
-		"redirect_uri":  a.cfg.redirectUrl,
+		"redirect_uri":  redirect,
 	})
+}
+
+func (a *apple) requestToken(ctx context.Context, params map[string]string) (token *oauth2.Token, IDToken string, err error) {
+	data, err := a.httpRequest(ctx, "POST", a.ep.TokenURL, params)
 	if err != nil {
 		return
 	}
@@ -123,7 +216,7 @@ func (a *apple) getToken(code string) (token *oauth2.Token, IDToken string, err
 	return
 }
 
-func (a *apple) httpRequest(method, addr string, params map[string]string) ([]byte, error) {
+func (a *apple) httpRequest(ctx context.Context, method, addr string, params map[string]string) ([]byte, error) {
 	form := url.Values{}
 	for k, v := range params {
 		form.Set(k, v)
@@ -131,13 +224,13 @@ func (a *apple) httpRequest(method, addr string, params map[string]string) ([]by
 
 	var request *http.Request
 	var err error
-	if request, err = http.NewRequest(method, addr, strings.NewReader(form.Encode())); err != nil {
+	if request, err = http.NewRequestWithContext(ctx, method, addr, strings.NewReader(form.Encode())); err != nil {
 		return nil, err
 	}
 	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	var response *http.Response
-	if response, err = http.DefaultClient.Do(request); nil != err {
+	if response, err = httpClient(ctx).Do(request); nil != err {
 		return nil, err
 	}
 	defer response.Body.Close()
@@ -2,10 +2,11 @@ package oauth2
 
 import (
 	"context"
+	"errors"
 	"github.com/casdoor/casdoor-go-sdk/casdoorsdk"
 	"github.com/dmzlingyin/utils/config"
 	"golang.org/x/oauth2"
-	"os"
+	"net/url"
 )
 
 func NewCasdoor() Provider {
@@ -14,23 +15,58 @@ func NewCasdoor() Provider {
 	clientSecret := config.GetString("oauth2.casdoor.client_secret")
 	organization := config.GetString("oauth2.casdoor.organization")
 	application := config.GetString("oauth2.casdoor.application")
-	file, err := os.ReadFile("config/cert")
-	if err != nil {
-		panic(err)
+	return must(NewCasdoorWith(
+		ClientID(clientID),
+		ClientSecret(clientSecret),
+		RedirectURL(config.GetString("oauth2.casdoor.redirect_url")),
+		CasdoorApp(endpoint, organization, application, configFile("oauth2.casdoor.cert_path")),
+	))
+}
+
+func NewCasdoorWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts)
+	// 登录页面默认与接口位于同一地址
+	ep := o.resolveEndpoints(Endpoints{APIURL: o.endpoint})
+	if ep.AuthURL == "" {
+		ep.AuthURL = ep.APIURL + "/login/oauth/authorize"
+	}
+	if ep.APIURL == "" || len(o.certificate) == 0 {
+		return nil, errors.New("the endpoint or certificate of casdoor is empty")
 	}
-	casdoorsdk.InitConfig(endpoint, clientID, clientSecret, string(file), organization, application)
-	return &casdoor{}
+	return &casdoor{
+		client:      casdoorsdk.NewClient(ep.APIURL, o.clientID, o.clientSecret, string(o.certificate), o.organization, o.application),
+		authURL:     ep.AuthURL,
+		clientID:    o.clientID,
+		redirectURL: o.redirectURL,
+	}, nil
 }
 
-type casdoor struct{}
+type casdoor struct {
+	client      *casdoorsdk.Client
+	authURL     string
+	clientID    string
+	redirectURL string
+}
+
+func (c *casdoor) AuthCodeURL(state, _, redirect string) string {
+	if redirect == "" {
+		redirect = c.redirectURL
+	}
+	q := url.Values{}
+	q.Set("client_id", c.clientID)
+	q.Set("response_type", "code")
+	q.Set("redirect_uri", redirect)
+	q.Set("scope", "read")
+	q.Set("state", state)
+	return c.authURL + "?" + q.Encode()
+}
 
 func (c *casdoor) Authorize(_ context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
-	state := "marmot"
-	token, err = casdoorsdk.GetOAuthToken(args.Code, state)
+	token, err = c.client.GetOAuthToken(args.Code, args.State)
 	if err != nil {
 		return
 	}
-	claims, err := casdoorsdk.ParseJwtToken(token.AccessToken)
+	claims, err := c.client.ParseJwtToken(token.AccessToken)
 	if err != nil {
 		return
 	}
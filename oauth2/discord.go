@@ -5,14 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/dmzlingyin/utils/config"
 	"golang.org/x/oauth2"
+	"net/url"
 )
 
 const (
-	DiscordAuthURL  = "https://discord.com/oauth2/authorize"
-	DiscordTokenURL = "https://discord.com/api/oauth2/token"
-	DiscordUserURL  = "https://discord.com/api/users/@me"
+	DiscordAuthURL   = "https://discord.com/oauth2/authorize"
+	DiscordTokenURL  = "https://discord.com/api/oauth2/token"
+	DiscordUserURL   = "https://discord.com/api/users/@me"
+	DiscordRevokeURL = "https://discord.com/api/oauth2/token/revoke"
 )
 
 const (
@@ -21,29 +22,34 @@ const (
 )
 
 func NewDiscord() Provider {
-	cfg := &oauth2.Config{
-		ClientID:     config.GetString("oauth2.discord.client_id"),
-		ClientSecret: config.GetString("oauth2.discord.client_secret"),
-		Endpoint: oauth2.Endpoint{
-			AuthURL:   DiscordAuthURL,
-			TokenURL:  DiscordTokenURL,
-			AuthStyle: oauth2.AuthStyleInParams,
-		},
-		RedirectURL: config.GetString("oauth2.discord.redirect_url"),
-		Scopes:      []string{DiscordScopeUser, DiscordScopeEmail},
-	}
+	return must(NewDiscordWith(configOptions("oauth2.discord")...))
+}
 
+func NewDiscordWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts, DiscordScopeUser, DiscordScopeEmail)
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL:   DiscordAuthURL,
+		TokenURL:  DiscordTokenURL,
+		UserURL:   DiscordUserURL,
+		RevokeURL: DiscordRevokeURL,
+	})
 	return &discord{
-		cfg: cfg,
-	}
+		cfg: o.oauth2Config(ep.AuthURL, ep.TokenURL),
+		ep:  ep,
+	}, nil
 }
 
 type discord struct {
 	cfg *oauth2.Config
+	ep  Endpoints
+}
+
+func (d *discord) AuthCodeURL(state, verifier, redirect string) string {
+	return authCodeURL(d.cfg, state, verifier, redirect, false)
 }
 
 func (d *discord) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
-	token, err = d.cfg.Exchange(ctx, args.Code)
+	token, err = d.cfg.Exchange(ctx, args.Code, exchangeOptions(args, false)...)
 	if err != nil {
 		return
 	} else if !token.Valid() {
@@ -51,7 +57,7 @@ func (d *discord) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.
 		return
 	}
 
-	res, err := d.cfg.Client(ctx, token).Get(DiscordUserURL)
+	res, err := d.cfg.Client(ctx, token).Get(d.ep.UserURL)
 	if err != nil {
 		return
 	}
@@ -78,3 +84,11 @@ func (d *discord) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.
 		Avatar:   avatar,
 	}, nil
 }
+
+func (d *discord) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return refreshWithConfig(ctx, d.cfg, refreshToken)
+}
+
+func (d *discord) Revoke(ctx context.Context, token string) error {
+	return revokeToken(ctx, d.ep.RevokeURL, url.Values{"token": {token}}, d.cfg.ClientID, d.cfg.ClientSecret)
+}
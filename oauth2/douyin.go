@@ -0,0 +1,131 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dmzlingyin/utils/config"
+	"golang.org/x/oauth2"
+	"net/url"
+	"time"
+)
+
+const (
+	DouyinAuthURL  = "https://open.douyin.com/platform/oauth/connect/"
+	DouyinTokenURL = "https://open.douyin.com/oauth/access_token/"
+	DouyinUserURL  = "https://open.douyin.com/oauth/userinfo/"
+)
+
+const DouyinScopeUserInfo = "user_info"
+
+func NewDouyin() Provider {
+	return must(NewDouyinWith(
+		ClientID(config.GetString("oauth2.douyin.client_key")),
+		ClientSecret(config.GetString("oauth2.douyin.client_secret")),
+		RedirectURL(config.GetString("oauth2.douyin.redirect_url")),
+	))
+}
+
+func NewDouyinWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts)
+	return &douyin{
+		clientKey:    o.clientID,
+		clientSecret: o.clientSecret,
+		redirectURL:  o.redirectURL,
+		ep: o.resolveEndpoints(Endpoints{
+			AuthURL:  DouyinAuthURL,
+			TokenURL: DouyinTokenURL,
+			UserURL:  DouyinUserURL,
+		}),
+	}, nil
+}
+
+type douyin struct {
+	clientKey    string
+	clientSecret string
+	redirectURL  string
+	ep           Endpoints
+}
+
+// douyinResp 抖音开放平台接口统一的返回结构
+type douyinResp[T any] struct {
+	Data    T      `json:"data"`
+	Message string `json:"message"`
+}
+
+type douyinError struct {
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+func (e douyinError) err() error {
+	if e.ErrorCode == 0 {
+		return nil
+	}
+	return fmt.Errorf("douyin error: %d %s", e.ErrorCode, e.Description)
+}
+
+func (d *douyin) AuthCodeURL(state, _, redirect string) string {
+	if redirect == "" {
+		redirect = d.redirectURL
+	}
+	q := url.Values{}
+	q.Set("client_key", d.clientKey)
+	q.Set("response_type", "code")
+	q.Set("scope", DouyinScopeUserInfo)
+	q.Set("redirect_uri", redirect)
+	q.Set("state", state)
+	return d.ep.AuthURL + "?" + q.Encode()
+}
+
+func (d *douyin) Authorize(ctx context.Context, args *AuthArgs) (*oauth2.Token, *User, error) {
+	v := url.Values{}
+	v.Set("client_key", d.clientKey)
+	v.Set("client_secret", d.clientSecret)
+	v.Set("code", args.Code)
+	v.Set("grant_type", "authorization_code")
+	var tr douyinResp[struct {
+		douyinError
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		OpenID       string `json:"open_id"`
+	}]
+	if err := postForm(ctx, d.ep.TokenURL, v, &tr); err != nil {
+		return nil, nil, err
+	}
+	if err := tr.Data.err(); err != nil {
+		return nil, nil, err
+	}
+	if tr.Data.AccessToken == "" {
+		return nil, nil, errors.New("invalid token")
+	}
+	token := &oauth2.Token{
+		AccessToken:  tr.Data.AccessToken,
+		RefreshToken: tr.Data.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(tr.Data.ExpiresIn) * time.Second),
+	}
+
+	v = url.Values{}
+	v.Set("access_token", tr.Data.AccessToken)
+	v.Set("open_id", tr.Data.OpenID)
+	var ur douyinResp[struct {
+		douyinError
+		OpenID   string `json:"open_id"`
+		UnionID  string `json:"union_id"`
+		Nickname string `json:"nickname"`
+		Avatar   string `json:"avatar"`
+	}]
+	if err := postForm(ctx, d.ep.UserURL, v, &ur); err != nil {
+		return nil, nil, err
+	}
+	if err := ur.Data.err(); err != nil {
+		return nil, nil, err
+	}
+	return token, &User{
+		ID:       ur.Data.OpenID,
+		Username: ur.Data.Nickname,
+		Avatar:   ur.Data.Avatar,
+		UnionID:  ur.Data.UnionID,
+	}, nil
+}
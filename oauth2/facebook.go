@@ -3,15 +3,19 @@ package oauth2
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/dmzlingyin/utils/config"
 	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"time"
 )
 
 const (
 	FacebookAuthURL  = "https://www.facebook.com/v18.0/dialog/oauth"
 	FacebookTokenURL = "https://graph.facebook.com/oauth/access_token"
 	FacebookUserURL  = "https://graph.facebook.com/me?fields=id,name,email,picture"
+	FacebookDebugURL = "https://graph.facebook.com/debug_token"
 )
 
 const (
@@ -21,35 +25,106 @@ const (
 )
 
 func NewFacebook() Provider {
+	return must(NewFacebookWith(configOptions("oauth2.facebook")...))
+}
+
+func NewFacebookWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts, FacebookScopeProfile, FacebookScopeEmail, FacebookScopePicture)
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL:      FacebookAuthURL,
+		TokenURL:     FacebookTokenURL,
+		UserURL:      FacebookUserURL,
+		TokenInfoURL: FacebookDebugURL,
+	})
 	return &facebook{
-		cfg: &oauth2.Config{
-			ClientID:     config.GetString("oauth2.facebook.client_id"),
-			ClientSecret: config.GetString("oauth2.facebook.client_secret"),
-			Endpoint: oauth2.Endpoint{
-				AuthURL:   FacebookAuthURL,
-				TokenURL:  FacebookTokenURL,
-				AuthStyle: oauth2.AuthStyleInParams,
-			},
-			RedirectURL: config.GetString("oauth2.facebook.redirect_url"),
-			Scopes:      []string{FacebookScopeProfile, FacebookScopeEmail, FacebookScopePicture},
-		},
-	}
+		cfg: o.oauth2Config(ep.AuthURL, ep.TokenURL),
+		ep:  ep,
+	}, nil
 }
 
 type facebook struct {
 	cfg *oauth2.Config
+	ep  Endpoints
+}
+
+func (g *facebook) AuthCodeURL(state, verifier, redirect string) string {
+	return authCodeURL(g.cfg, state, verifier, redirect, true)
 }
 
 func (g *facebook) Authorize(ctx context.Context, args *AuthArgs) (*oauth2.Token, *User, error) {
+	if args.Token != "" {
+		token, err := g.debugToken(ctx, args.Token)
+		if err != nil {
+			return nil, nil, err
+		}
+		return g.getUser(ctx, token)
+	}
+
 	// code -> token
-	token, err := g.cfg.Exchange(ctx, args.Code)
+	token, err := g.cfg.Exchange(ctx, args.Code, exchangeOptions(args, true)...)
 	if err != nil {
 		return nil, nil, err
 	} else if !token.Valid() {
 		return nil, nil, fmt.Errorf("invalid token %w", err)
 	}
+	return g.getUser(ctx, token)
+}
+
+// debugToken 校验客户端传递的 access token 是否有效且属于本应用
+func (g *facebook) debugToken(ctx context.Context, accessToken string) (*oauth2.Token, error) {
+	q := url.Values{}
+	q.Set("input_token", accessToken)
+	q.Set("access_token", g.cfg.ClientID+"|"+g.cfg.ClientSecret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.ep.TokenInfoURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var r struct {
+		Data struct {
+			AppID     string `json:"app_id"`
+			IsValid   bool   `json:"is_valid"`
+			UserID    string `json:"user_id"`
+			ExpiresAt int64  `json:"expires_at"`
+			Error     struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"data"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	if r.Error.Message != "" {
+		return nil, errors.New(r.Error.Message)
+	}
+	if !r.Data.IsValid {
+		return nil, fmt.Errorf("invalid facebook token: %s", r.Data.Error.Message)
+	}
+	if r.Data.AppID != g.cfg.ClientID {
+		return nil, errors.New("facebook token is not issued for this app")
+	}
+
+	token := &oauth2.Token{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+	}
+	// expires_at 为 0 表示永不过期
+	if r.Data.ExpiresAt > 0 {
+		token.Expiry = time.Unix(r.Data.ExpiresAt, 0)
+	}
+	return token, nil
+}
 
-	res, err := g.cfg.Client(ctx, token).Get(FacebookUserURL)
+func (g *facebook) getUser(ctx context.Context, token *oauth2.Token) (*oauth2.Token, *User, error) {
+	res, err := g.cfg.Client(ctx, token).Get(g.ep.UserURL)
 	if err != nil {
 		return nil, nil, err
 	}
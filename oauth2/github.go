@@ -0,0 +1,121 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"net/http"
+	"strconv"
+)
+
+const (
+	GithubAuthURL  = "https://github.com/login/oauth/authorize"
+	GithubTokenURL = "https://github.com/login/oauth/access_token"
+	GithubUserURL  = "https://api.github.com/user"
+)
+
+const (
+	GithubScopeUser  = "read:user"
+	GithubScopeEmail = "user:email"
+)
+
+func NewGithub() Provider {
+	return must(NewGithubWith(configOptions("oauth2.github")...))
+}
+
+func NewGithubWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts, GithubScopeUser, GithubScopeEmail)
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL:  GithubAuthURL,
+		TokenURL: GithubTokenURL,
+		UserURL:  GithubUserURL,
+	})
+	return &github{
+		cfg: o.oauth2Config(ep.AuthURL, ep.TokenURL),
+		ep:  ep,
+	}, nil
+}
+
+type github struct {
+	cfg *oauth2.Config
+	ep  Endpoints
+}
+
+func (g *github) AuthCodeURL(state, verifier, redirect string) string {
+	return authCodeURL(g.cfg, state, verifier, redirect, false)
+}
+
+func (g *github) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
+	token, err = g.cfg.Exchange(ctx, args.Code, exchangeOptions(args, false)...)
+	if err != nil {
+		return
+	} else if !token.Valid() {
+		err = errors.New("invalid token")
+		return
+	}
+
+	client := g.cfg.Client(ctx, token)
+	var u struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err = g.get(ctx, client, g.ep.UserURL, &u); err != nil {
+		return nil, nil, err
+	}
+
+	// 公开邮箱可能为空或未验证, 只使用已验证的主邮箱
+	email, err := g.primaryEmail(ctx, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	username := u.Name
+	if username == "" {
+		username = u.Login
+	}
+	return token, &User{
+		ID:            strconv.FormatInt(u.ID, 10),
+		Username:      username,
+		Email:         email,
+		EmailVerified: email != "",
+		Avatar:        u.AvatarURL,
+	}, nil
+}
+
+func (g *github) primaryEmail(ctx context.Context, client *http.Client) (string, error) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := g.get(ctx, client, g.ep.UserURL+"/emails", &emails); err != nil {
+		return "", err
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email, nil
+		}
+	}
+	return "", nil
+}
+
+func (g *github) get(ctx context.Context, client *http.Client, addr string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("github api error, status: %d", res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -4,16 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"github.com/dmzlingyin/utils/config"
 	"github.com/dmzlingyin/utils/oauth2/jwt"
 	"golang.org/x/oauth2"
+	"net/url"
 )
 
 const (
-	GoogleAuthURL  = "https://accounts.google.com/o/oauth2/v2/auth"
-	GoogleTokenURL = "https://oauth2.googleapis.com/token"
-	GoogleUserURL  = "https://www.googleapis.com/oauth2/v3/userinfo"
-	GoogleKeyURL   = "https://www.googleapis.com/oauth2/v3/certs"
+	GoogleAuthURL   = "https://accounts.google.com/o/oauth2/v2/auth"
+	GoogleTokenURL  = "https://oauth2.googleapis.com/token"
+	GoogleUserURL   = "https://www.googleapis.com/oauth2/v3/userinfo"
+	GoogleKeyURL    = "https://www.googleapis.com/oauth2/v3/certs"
+	GoogleIssuer    = "https://accounts.google.com"
+	GoogleRevokeURL = "https://oauth2.googleapis.com/revoke"
 )
 
 const (
@@ -22,31 +24,45 @@ const (
 )
 
 func NewGoogle() Provider {
-	cfg := &oauth2.Config{
-		ClientID:     config.GetString("oauth2.google.client_id"),
-		ClientSecret: config.GetString("oauth2.google.client_secret"),
-		Endpoint: oauth2.Endpoint{
-			AuthURL:   GoogleAuthURL,
-			TokenURL:  GoogleTokenURL,
-			AuthStyle: oauth2.AuthStyleInParams,
-		},
-		RedirectURL: config.GetString("oauth2.google.redirect_url"),
-		Scopes:      []string{GoogleScopeProfile, GoogleScopeEmail},
-	}
+	return must(NewGoogleWith(configOptions("oauth2.google")...))
+}
 
+func NewGoogleWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts, GoogleScopeProfile, GoogleScopeEmail)
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL:   GoogleAuthURL,
+		TokenURL:  GoogleTokenURL,
+		UserURL:   GoogleUserURL,
+		KeyURL:    GoogleKeyURL,
+		RevokeURL: GoogleRevokeURL,
+		Issuer:    GoogleIssuer,
+	})
+	// 移动端的 client id 与网页端不同, 都需要作为 ID token 的受众
+	audiences := append([]string{o.clientID}, o.audiences...)
+	decoder := jwt.NewDecoder(ep.KeyURL, jwt.Issuers(ep.Issuer, "accounts.google.com"), jwt.Audiences(audiences...))
 	return &google{
-		cfg:     cfg,
-		decoder: jwt.NewDecoder(GoogleKeyURL),
-	}
+		cfg:     o.oauth2Config(ep.AuthURL, ep.TokenURL),
+		ep:      ep,
+		decoder: decoder,
+	}, nil
 }
 
 type google struct {
 	cfg     *oauth2.Config
+	ep      Endpoints
 	decoder *jwt.Decoder
 }
 
+func (g *google) AuthCodeURL(state, verifier, redirect string) string {
+	return authCodeURL(g.cfg, state, verifier, redirect, true)
+}
+
 func (g *google) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
-	token, err = g.cfg.Exchange(ctx, args.Code)
+	if args.Token != "" {
+		return verifyIDToken(g.decoder, args.Token, args.Nonce)
+	}
+
+	token, err = g.cfg.Exchange(ctx, args.Code, exchangeOptions(args, true)...)
 	if err != nil {
 		return
 	} else if !token.Valid() {
@@ -54,25 +70,36 @@ func (g *google) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.T
 		return
 	}
 
-	res, err := g.cfg.Client(ctx, token).Get(GoogleUserURL)
+	res, err := g.cfg.Client(ctx, token).Get(g.ep.UserURL)
 	if err != nil {
 		return
 	}
 	defer res.Body.Close()
 
 	var u struct {
-		Sub     string `json:"sub"`
-		Name    string `json:"name"`
-		Email   string `json:"email"`
-		Picture string `json:"picture"`
+		Sub           string `json:"sub"`
+		Name          string `json:"name"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Picture       string `json:"picture"`
 	}
 	if err = json.NewDecoder(res.Body).Decode(&u); err != nil {
 		return nil, nil, err
 	}
 	return token, &User{
-		ID:       u.Sub,
-		Username: u.Name,
-		Email:    u.Email,
-		Avatar:   u.Picture,
+		ID:            u.Sub,
+		Username:      u.Name,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Avatar:        u.Picture,
 	}, nil
 }
+
+func (g *google) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return refreshWithConfig(ctx, g.cfg, refreshToken)
+}
+
+// Revoke access token 和 refresh token 都可以撤销, 撤销 refresh token 会同时撤销对应的 access token
+func (g *google) Revoke(ctx context.Context, token string) error {
+	return revokeToken(ctx, g.ep.RevokeURL, url.Values{"token": {token}}, "", "")
+}
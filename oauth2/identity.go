@@ -0,0 +1,259 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	mdb "github.com/dmzlingyin/utils/database/mongo"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+	"strings"
+	"time"
+)
+
+const DefaultIdentityCollection = "oauth2_identities"
+
+var (
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrIdentityLinked   = errors.New("identity is already linked to another account")
+	ErrLastIdentity     = errors.New("can't unlink the last identity of an account")
+)
+
+// unionTypes 共享 UnionID 的登录方式, 同一开放平台主体下的应用 UnionID 相同
+var unionTypes = [][]OauthType{
+	{TypeWechat, TypeWechatMini},
+}
+
+// Identity 第三方账号与内部账号的绑定关系
+type Identity struct {
+	AccountID     string    `bson:"account_id" json:"accountId"`
+	Type          OauthType `bson:"type" json:"type"`
+	ProviderID    string    `bson:"provider_id" json:"providerId"`
+	UnionID       string    `bson:"union_id,omitempty" json:"unionId,omitempty"`
+	Email         string    `bson:"email,omitempty" json:"email,omitempty"`
+	EmailVerified bool      `bson:"email_verified" json:"emailVerified"`
+	Username      string    `bson:"username,omitempty" json:"username,omitempty"`
+	Avatar        string    `bson:"avatar,omitempty" json:"avatar,omitempty"`
+	CreatedAt     time.Time `bson:"created_at" json:"createdAt"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updatedAt"`
+}
+
+type IdentityConfig struct {
+	Collection string // 默认 oauth2_identities
+	// 允许按邮箱合并账号的登录方式, 还要求平台返回的 User.EmailVerified 为 true, 为空时不合并
+	MergeEmailTypes []OauthType
+}
+
+// IdentityStore 基于 MongoDB 的账号绑定存储, 同一个人通过不同方式登录时映射到同一个内部账号
+type IdentityStore struct {
+	coll       *mongo.Collection
+	mergeTypes []OauthType
+}
+
+func NewIdentityStore(db *mongo.Database, cfg IdentityConfig) *IdentityStore {
+	if cfg.Collection == "" {
+		cfg.Collection = DefaultIdentityCollection
+	}
+	return &IdentityStore{
+		coll:       db.Collection(cfg.Collection),
+		mergeTypes: cfg.MergeEmailTypes,
+	}
+}
+
+// EnsureIndexes 创建唯一索引, 服务启动时调用一次即可
+func (s *IdentityStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "provider_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "account_id", Value: 1}}},
+		{Keys: bson.D{{Key: "union_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	return err
+}
+
+// Resolve 返回第三方账号对应的内部账号, 依次按绑定关系、UnionID、已验证邮箱查找, 都没有时创建新账号
+func (s *IdentityStore) Resolve(ctx context.Context, ot OauthType, u *User) (accountID string, created bool, err error) {
+	identity, err := s.Find(ctx, ot, u.ID)
+	if err == nil {
+		return identity.AccountID, false, s.updateProfile(ctx, ot, u)
+	} else if !errors.Is(err, ErrIdentityNotFound) {
+		return "", false, err
+	}
+
+	accountID, err = s.match(ctx, ot, u)
+	if err != nil {
+		return "", false, err
+	}
+	if accountID == "" {
+		accountID = uuid.NewString()
+		created = true
+	}
+	if err = s.insert(ctx, accountID, ot, u); err != nil {
+		// 并发登录时可能已被其他请求绑定
+		if mongo.IsDuplicateKeyError(err) {
+			if identity, err = s.Find(ctx, ot, u.ID); err == nil {
+				return identity.AccountID, false, nil
+			}
+		}
+		return "", false, err
+	}
+	return accountID, created, nil
+}
+
+// match 查找可以合并的已有账号
+func (s *IdentityStore) match(ctx context.Context, ot OauthType, u *User) (string, error) {
+	if u.UnionID != "" {
+		if types := unionGroup(ot); len(types) > 0 {
+			identity, err := mdb.FindOne[Identity](ctx, s.coll, bson.M{"union_id": u.UnionID, "type": bson.M{"$in": types}})
+			if err == nil {
+				return identity.AccountID, nil
+			} else if !errors.Is(err, mongo.ErrNoDocuments) {
+				return "", err
+			}
+		}
+	}
+	if s.emailVerified(ot, u) {
+		identity, err := mdb.FindOne[Identity](ctx, s.coll, bson.M{"email": normalizeEmail(u.Email), "email_verified": true})
+		if err == nil {
+			return identity.AccountID, nil
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func (s *IdentityStore) Find(ctx context.Context, ot OauthType, providerID string) (*Identity, error) {
+	identity, err := mdb.FindOne[Identity](ctx, s.coll, bson.M{"type": ot, "provider_id": providerID})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrIdentityNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// FindByUnionID 查找同一 UnionID 下绑定的所有第三方账号
+func (s *IdentityStore) FindByUnionID(ctx context.Context, unionID string) ([]Identity, error) {
+	return mdb.Fetch[[]Identity](ctx, s.coll, bson.M{"union_id": unionID}, nil)
+}
+
+// Identities 账号绑定的所有第三方账号
+func (s *IdentityStore) Identities(ctx context.Context, accountID string) ([]Identity, error) {
+	return mdb.Fetch[[]Identity](ctx, s.coll, bson.M{"account_id": accountID}, bson.D{{Key: "created_at", Value: 1}})
+}
+
+// Link 将第三方账号绑定到已登录的账号上
+func (s *IdentityStore) Link(ctx context.Context, accountID string, ot OauthType, u *User) error {
+	identity, err := s.Find(ctx, ot, u.ID)
+	if err == nil {
+		if identity.AccountID != accountID {
+			return ErrIdentityLinked
+		}
+		return s.updateProfile(ctx, ot, u)
+	} else if !errors.Is(err, ErrIdentityNotFound) {
+		return err
+	}
+	if err = s.insert(ctx, accountID, ot, u); mongo.IsDuplicateKeyError(err) {
+		return ErrIdentityLinked
+	}
+	return err
+}
+
+// Unlink 解除绑定, 账号至少需要保留一种登录方式.
+// 不依赖事务: 先删除再检查剩余数量, 没有剩余时恢复被删除的绑定, 并发解绑时至少有一个请求会恢复
+func (s *IdentityStore) Unlink(ctx context.Context, accountID string, ot OauthType) error {
+	removed, err := mdb.Fetch[[]Identity](ctx, s.coll, bson.M{"account_id": accountID, "type": ot}, nil)
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		return ErrIdentityNotFound
+	}
+	count, err := s.coll.CountDocuments(ctx, bson.M{"account_id": accountID})
+	if err != nil {
+		return err
+	}
+	if count <= int64(len(removed)) {
+		return ErrLastIdentity
+	}
+
+	ids := make([]string, len(removed))
+	for i, identity := range removed {
+		ids[i] = identity.ProviderID
+	}
+	if _, err = s.coll.DeleteMany(ctx, bson.M{"account_id": accountID, "type": ot, "provider_id": bson.M{"$in": ids}}); err != nil {
+		return err
+	}
+	if count, err = s.coll.CountDocuments(ctx, bson.M{"account_id": accountID}); err != nil || count > 0 {
+		return err
+	}
+
+	docs := make([]any, len(removed))
+	for i := range removed {
+		docs[i] = &removed[i]
+	}
+	// 恢复期间第三方账号可能已重新登录并创建了绑定, 忽略重复
+	if _, err = s.coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return ErrLastIdentity
+}
+
+func (s *IdentityStore) insert(ctx context.Context, accountID string, ot OauthType, u *User) error {
+	now := time.Now()
+	_, err := s.coll.InsertOne(ctx, &Identity{
+		AccountID:     accountID,
+		Type:          ot,
+		ProviderID:    u.ID,
+		UnionID:       u.UnionID,
+		Email:         normalizeEmail(u.Email),
+		EmailVerified: s.emailVerified(ot, u),
+		Username:      u.Username,
+		Avatar:        u.Avatar,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	return err
+}
+
+// updateProfile 同步第三方账号最新的资料, 空值不覆盖
+func (s *IdentityStore) updateProfile(ctx context.Context, ot OauthType, u *User) error {
+	set := bson.M{"updated_at": time.Now()}
+	if u.UnionID != "" {
+		set["union_id"] = u.UnionID
+	}
+	if u.Email != "" {
+		set["email"] = normalizeEmail(u.Email)
+		set["email_verified"] = s.emailVerified(ot, u)
+	}
+	if u.Username != "" {
+		set["username"] = u.Username
+	}
+	if u.Avatar != "" {
+		set["avatar"] = u.Avatar
+	}
+	_, err := s.coll.UpdateOne(ctx, bson.M{"type": ot, "provider_id": u.ID}, bson.M{"$set": set})
+	return err
+}
+
+// emailVerified 平台在允许合并的列表中, 并且确认了该用户的邮箱
+func (s *IdentityStore) emailVerified(ot OauthType, u *User) bool {
+	return u.Email != "" && u.EmailVerified && slices.Contains(s.mergeTypes, ot)
+}
+
+// normalizeEmail 邮箱不区分大小写, 统一转为小写保存和查询
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func unionGroup(ot OauthType) []OauthType {
+	for _, types := range unionTypes {
+		if slices.Contains(types, ot) {
+			return types
+		}
+	}
+	return nil
+}
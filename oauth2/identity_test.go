@@ -0,0 +1,128 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEmailVerified(t *testing.T) {
+	s := &IdentityStore{mergeTypes: []OauthType{TypeGoogle}}
+	cases := []struct {
+		ot   OauthType
+		user User
+		want bool
+	}{
+		{TypeGoogle, User{Email: "a@example.com", EmailVerified: true}, true},
+		// 平台允许合并, 但该用户的邮箱未验证
+		{TypeGoogle, User{Email: "a@example.com"}, false},
+		{TypeGoogle, User{EmailVerified: true}, false},
+		{TypeMicrosoft, User{Email: "a@example.com", EmailVerified: true}, false},
+	}
+	for _, c := range cases {
+		if got := s.emailVerified(c.ot, &c.user); got != c.want {
+			t.Errorf("%s %+v: got %v", c.ot, c.user, got)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	if got := normalizeEmail(" A@Example.COM "); got != "a@example.com" {
+		t.Fatalf("email should be lowercased, got %q", got)
+	}
+}
+
+// newTestIdentityStore 通过环境变量 MONGO_TEST_URI 指定测试使用的 MongoDB, 未设置时跳过
+func newTestIdentityStore(t *testing.T) *IdentityStore {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set, skipping identity store tests")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Ping(ctx, nil); err != nil {
+		t.Fatalf("mongo %s is not available: %v", uri, err)
+	}
+	db := client.Database("utils_test")
+	s := NewIdentityStore(db, IdentityConfig{
+		Collection:      "identities_" + uuid.NewString(),
+		MergeEmailTypes: []OauthType{TypeGoogle, TypeGithub},
+	})
+	t.Cleanup(func() {
+		_ = s.coll.Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+	})
+	if err = s.EnsureIndexes(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestIdentityStore(t *testing.T) {
+	s := newTestIdentityStore(t)
+	ctx := context.Background()
+
+	account, created, err := s.Resolve(ctx, TypeGoogle, &User{ID: "g1", Email: "a@example.com", EmailVerified: true})
+	if err != nil || !created {
+		t.Fatalf("account should be created: %v", err)
+	}
+	// 再次登录返回同一个账号
+	if again, created, err := s.Resolve(ctx, TypeGoogle, &User{ID: "g1", Email: "a@example.com", EmailVerified: true}); err != nil || created || again != account {
+		t.Fatalf("identity should be found: %s, %v", again, err)
+	}
+	// 已验证的邮箱合并到同一个账号, 邮箱不区分大小写
+	merged, created, err := s.Resolve(ctx, TypeGithub, &User{ID: "gh1", Email: "A@Example.com", EmailVerified: true})
+	if err != nil || created || merged != account {
+		t.Fatalf("github should be merged: %s, %v", merged, err)
+	}
+	// 未验证的邮箱不能合并, 即使平台在允许列表中
+	other, created, err := s.Resolve(ctx, TypeGoogle, &User{ID: "g2", Email: "a@example.com"})
+	if err != nil || !created || other == account {
+		t.Fatalf("unverified email should not be merged: %s, %v", other, err)
+	}
+
+	if err = s.Link(ctx, account, TypeLine, &User{ID: "l1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Link(ctx, other, TypeLine, &User{ID: "l1"}); !errors.Is(err, ErrIdentityLinked) {
+		t.Fatalf("linked identity should be rejected, got %v", err)
+	}
+	identities, err := s.Identities(ctx, account)
+	if err != nil || len(identities) != 3 {
+		t.Fatalf("account should have 3 identities, got %d, %v", len(identities), err)
+	}
+
+	if err = s.Unlink(ctx, other, TypeGoogle); !errors.Is(err, ErrLastIdentity) {
+		t.Fatalf("last identity should not be unlinked, got %v", err)
+	}
+	if err = s.Unlink(ctx, account, TypeLine); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Unlink(ctx, account, TypeLine); !errors.Is(err, ErrIdentityNotFound) {
+		t.Fatalf("identity should be unlinked, got %v", err)
+	}
+
+	// 并发解绑时账号至少保留一种登录方式
+	var wg sync.WaitGroup
+	for _, ot := range []OauthType{TypeGoogle, TypeGithub} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = s.Unlink(ctx, account, ot)
+		}()
+	}
+	wg.Wait()
+	if identities, err = s.Identities(ctx, account); err != nil || len(identities) == 0 {
+		t.Fatalf("account should keep an identity, got %d, %v", len(identities), err)
+	}
+}
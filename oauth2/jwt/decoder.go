@@ -1,14 +1,39 @@
 package jwt
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"math/big"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultKeyTTL          = time.Hour
+	DefaultLeeway          = time.Minute
+	DefaultRefreshInterval = time.Minute
+	DefaultFetchTimeout    = 10 * time.Second
+)
+
+var (
+	ErrUnknownKey       = errors.New("jwt: unknown key id")
+	ErrInvalidIssuer    = errors.New("jwt: invalid issuer")
+	ErrInvalidAudience  = errors.New("jwt: invalid audience")
+	ErrInvalidNonce     = errors.New("jwt: invalid nonce")
+	ErrTokenExpired     = errors.New("jwt: token is expired")
+	ErrMissingExpiry    = errors.New("jwt: token has no exp claim")
+	ErrTokenNotValidYet = errors.New("jwt: token is not valid yet")
 )
 
 type Keys struct {
@@ -16,106 +41,336 @@ type Keys struct {
 	Kid string `json:"kid"`
 	Use string `json:"use"`
 	Alg string `json:"alg"`
-	N   string `json:"n"`
-	E   string `json:"e"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// StringList aud 既可能是字符串也可能是数组
+type StringList []string
+
+func (s *StringList) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case string:
+		*s = StringList{val}
+	case []any:
+		list := make(StringList, 0, len(val))
+		for _, item := range val {
+			str, ok := item.(string)
+			if !ok {
+				return errors.New("jwt: invalid string list")
+			}
+			list = append(list, str)
+		}
+		*s = list
+	case nil:
+		*s = nil
+	default:
+		return errors.New("jwt: invalid string list")
+	}
+	return nil
+}
+
+// Bool 苹果的 email_verified 等声明可能是字符串 "true"/"false"
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case bool:
+		*b = Bool(val)
+	case string:
+		*b = Bool(val == "true")
+	case nil:
+		*b = false
+	default:
+		return errors.New("jwt: invalid bool")
+	}
+	return nil
 }
 
 type Claims struct {
 	jwt.StandardClaims
-	Email   string `json:"email,omitempty"`
-	Name    string `json:"name,omitempty"`
-	Picture string `json:"picture,omitempty"`
+	// 覆盖 StandardClaims.Audience, 兼容数组格式
+	Audience StringList `json:"aud,omitempty"`
+	Nonce    string     `json:"nonce,omitempty"`
+	Email    string     `json:"email,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Picture  string     `json:"picture,omitempty"`
+	// OIDC 标准声明
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	PhoneNumber       string `json:"phone_number,omitempty"`
+	EmailVerified     Bool   `json:"email_verified,omitempty"`
 }
 
-func NewDecoder(url string) *Decoder {
-	return &Decoder{
-		keyURL: url,
-		cache:  make(map[string]Keys),
+// Valid 时间等声明由 Decoder 统一校验(支持时钟偏差)
+func (c *Claims) Valid() error {
+	return nil
+}
+
+func NewDecoder(url string, opts ...Option) *Decoder {
+	d := &Decoder{
+		keyURL:          url,
+		leeway:          DefaultLeeway,
+		refreshInterval: DefaultRefreshInterval,
+		fetchTimeout:    DefaultFetchTimeout,
+		client:          http.DefaultClient,
+		keys:            make(map[string]any),
+	}
+	for _, opt := range opts {
+		opt.apply(d)
 	}
+	return d
 }
 
 type Decoder struct {
-	keyURL string
-	cache  map[string]Keys
+	keyURL          string
+	issuers         []string
+	audiences       []string
+	leeway          time.Duration
+	refreshInterval time.Duration
+	fetchTimeout    time.Duration
+	client          *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]any // kid -> *rsa.PublicKey / *ecdsa.PublicKey
+	expiry    time.Time      // 公钥缓存的过期时间
+	lastFetch time.Time
+	lastErr   error
+	fetchMu   sync.Mutex // 避免并发重复拉取
 }
 
+// Decode 验证 token 的签名及 iss/aud/exp/nbf 并返回声明
 func (d *Decoder) Decode(token string) (*Claims, error) {
-	resp, err := http.Get(d.keyURL)
+	return d.DecodeWithNonce(token, "")
+}
+
+// DecodeWithNonce 同 Decode, nonce 不为空时还会校验 token 中的 nonce
+func (d *Decoder) DecodeWithNonce(token, nonce string) (*Claims, error) {
+	t, err := jwt.ParseWithClaims(token, &Claims{}, d.keyFunc)
 	if err != nil {
 		return nil, err
+	} else if t == nil || !t.Valid {
+		return nil, errors.New("jwt: invalid token")
 	}
-	defer resp.Body.Close()
+	claims, ok := t.Claims.(*Claims)
+	if !ok {
+		return nil, errors.New("jwt: invalid claims")
+	}
+	if err = d.validate(claims, nonce); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
 
-	var data struct {
-		Keys []struct {
-			Kty string `json:"kty"`
-			Kid string `json:"kid"`
-			Use string `json:"use"`
-			Alg string `json:"alg"`
-			N   string `json:"n"`
-			E   string `json:"e"`
-		} `json:"keys"`
+func (d *Decoder) validate(c *Claims, nonce string) error {
+	now := time.Now()
+	// ID token 必须包含 exp, 缺少时视为无效而不是永不过期
+	if c.ExpiresAt == 0 {
+		return ErrMissingExpiry
 	}
-	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+	if now.After(time.Unix(c.ExpiresAt, 0).Add(d.leeway)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Before(time.Unix(c.NotBefore, 0).Add(-d.leeway)) {
+		return ErrTokenNotValidYet
+	}
+	if c.IssuedAt != 0 && now.Before(time.Unix(c.IssuedAt, 0).Add(-d.leeway)) {
+		return ErrTokenNotValidYet
+	}
+	if len(d.issuers) > 0 && !slices.Contains(d.issuers, c.Issuer) {
+		return ErrInvalidIssuer
+	}
+	if len(d.audiences) > 0 && !slices.ContainsFunc(c.Audience, func(aud string) bool {
+		return slices.Contains(d.audiences, aud)
+	}) {
+		return ErrInvalidAudience
+	}
+	if nonce != "" && c.Nonce != nonce {
+		return ErrInvalidNonce
+	}
+	return nil
+}
+
+func (d *Decoder) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, err := d.getPublicKey(kid)
+	if err != nil {
 		return nil, err
 	}
-	for _, key := range data.Keys {
-		d.cache[key.Kid] = key
+	// 签名算法必须与公钥类型一致, 防止算法混淆
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("jwt: unexpected signing method %s", t.Method.Alg())
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := t.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, fmt.Errorf("jwt: unexpected signing method %s", t.Method.Alg())
+		}
 	}
-	return d.getSubFromToken(token)
+	return key, nil
 }
 
-// 获取userID
-func (d *Decoder) getSubFromToken(idToken string) (*Claims, error) {
-	// 数据由 头部、载荷、签名 三部分组成
-	cliTokenArr := strings.Split(idToken, ".")
+// getPublicKey 优先使用缓存, 缓存过期或遇到未知 kid 时重新拉取
+func (d *Decoder) getPublicKey(kid string) (any, error) {
+	d.mu.RLock()
+	key, ok := d.keys[kid]
+	fresh := time.Now().Before(d.expiry)
+	d.mu.RUnlock()
+	if ok && fresh {
+		return key, nil
+	}
 
-	// 解析token的header获取kid
-	cliHeader, err := jwt.DecodeSegment(cliTokenArr[0])
-	if err != nil {
+	if err := d.refresh(); err != nil {
+		// 拉取失败时继续使用过期的公钥
+		if ok {
+			return key, nil
+		}
 		return nil, err
 	}
 
-	var jHeader struct {
-		Kid string `json:"kid"`
-		Alg string `json:"alg"`
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if key, ok = d.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// refresh 重新拉取公钥, 两次拉取的间隔不小于 refreshInterval
+func (d *Decoder) refresh() error {
+	d.fetchMu.Lock()
+	defer d.fetchMu.Unlock()
+
+	d.mu.RLock()
+	lastFetch, lastErr := d.lastFetch, d.lastErr
+	d.mu.RUnlock()
+	if time.Since(lastFetch) < d.refreshInterval {
+		return lastErr
 	}
-	err = json.Unmarshal(cliHeader, &jHeader)
+
+	now := time.Now()
+	keys, ttl, err := d.fetch()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastFetch = now
+	d.lastErr = err
 	if err != nil {
-		return nil, err
+		return err
 	}
+	d.keys = keys
+	d.expiry = now.Add(ttl)
+	return nil
+}
 
-	// 效验pubKey 及 token
-	token, err := jwt.ParseWithClaims(idToken, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return d.getPublicKey(jHeader.Kid), nil
-	})
+// fetch 在 fetchMu 下执行, 需要限制超时, 避免公钥服务无响应时阻塞所有验证
+func (d *Decoder) fetch() (map[string]any, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.keyURL, nil)
 	if err != nil {
-		return nil, err
-	} else if token == nil {
-		return nil, errors.New("nil token")
+		return nil, 0, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, 0, err
 	}
-	claims, ok := token.Claims.(*Claims)
-	if ok && token.Valid {
-		return claims, nil
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("jwt: fetch keys error, status: %d", resp.StatusCode)
 	}
-	return nil, errors.New("get userID err")
-}
 
-func (d *Decoder) getPublicKey(keyId string) *rsa.PublicKey {
-	// 获取验证所需的公钥
-	var pubKey rsa.PublicKey
-	var keys Keys
-	if key, ok := d.cache[keyId]; ok {
-		keys = key
-		nBin, _ := base64.RawURLEncoding.DecodeString(keys.N)
-		nData := new(big.Int).SetBytes(nBin)
+	var data struct {
+		Keys []Keys `json:"keys"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, 0, err
+	}
+	keys := make(map[string]any, len(data.Keys))
+	for _, k := range data.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, maxAge(resp.Header.Get("Cache-Control")), nil
+}
 
-		eBin, _ := base64.RawURLEncoding.DecodeString(keys.E)
-		eData := new(big.Int).SetBytes(eBin)
+// PublicKey 将 JWK 转换为 *rsa.PublicKey 或 *ecdsa.PublicKey
+func (k *Keys) PublicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		nBin, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		eBin, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBin),
+			E: int(new(big.Int).SetBytes(eBin).Uint64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("jwt: unsupported curve %s", k.Crv)
+		}
+		xBin, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		yBin, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(xBin),
+			Y:     new(big.Int).SetBytes(yBin),
+		}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("jwt: invalid ec key")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("jwt: unsupported key type %s", k.Kty)
+	}
+}
 
-		pubKey.N = nData
-		pubKey.E = int(eData.Uint64())
-		return &pubKey
+// maxAge 解析 Cache-Control 中的 max-age, 没有时使用默认值
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if v, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+				return time.Duration(sec) * time.Second
+			}
+		}
 	}
-	return nil
+	return DefaultKeyTTL
 }
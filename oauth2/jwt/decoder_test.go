@@ -0,0 +1,134 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDecoder(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding
+	keys := []Keys{
+		{Kty: "EC", Kid: "ec", Use: "sig", Alg: "ES256", Crv: "P-256",
+			X: enc.EncodeToString(ecKey.X.Bytes()), Y: enc.EncodeToString(ecKey.Y.Bytes())},
+		{Kty: "RSA", Kid: "rsa", Use: "sig", Alg: "RS256",
+			N: enc.EncodeToString(rsaKey.N.Bytes()), E: enc.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+	}
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer srv.Close()
+
+	d := NewDecoder(srv.URL, Issuers("https://issuer"), Audiences("client"))
+	sign := func(method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   "https://issuer",
+		"sub":   "user",
+		"aud":   []string{"other", "client"},
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": "n",
+	}
+
+	c, err := d.DecodeWithNonce(sign(jwt.SigningMethodES256, "ec", ecKey, claims), "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject != "user" {
+		t.Fatal("invalid subject: " + c.Subject)
+	}
+	if _, err = d.Decode(sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims)); err != nil {
+		t.Fatal(err)
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("keys should be cached, fetches: %d", fetches.Load())
+	}
+
+	if _, err = d.DecodeWithNonce(sign(jwt.SigningMethodES256, "ec", ecKey, claims), "x"); err != ErrInvalidNonce {
+		t.Fatal("nonce should be checked")
+	}
+	claims["aud"] = "other"
+	if _, err = d.Decode(sign(jwt.SigningMethodES256, "ec", ecKey, claims)); err != ErrInvalidAudience {
+		t.Fatal("audience should be checked")
+	}
+	claims["aud"] = "client"
+	claims["exp"] = now.Add(-2 * DefaultLeeway).Unix()
+	if _, err = d.Decode(sign(jwt.SigningMethodES256, "ec", ecKey, claims)); err != ErrTokenExpired {
+		t.Fatal("exp should be checked")
+	}
+	delete(claims, "exp")
+	if _, err = d.Decode(sign(jwt.SigningMethodES256, "ec", ecKey, claims)); err != ErrMissingExpiry {
+		t.Fatal("exp should be required")
+	}
+	// 时钟偏差内的过期 token 可以通过
+	claims["exp"] = now.Add(-DefaultLeeway / 2).Unix()
+	if _, err = d.Decode(sign(jwt.SigningMethodES256, "ec", ecKey, claims)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未知 kid 会触发重新拉取, 但受频率限制
+	if _, err = d.Decode(sign(jwt.SigningMethodES256, "unknown", ecKey, claims)); err == nil {
+		t.Fatal("unknown kid should be rejected")
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("refresh should be rate limited, fetches: %d", fetches.Load())
+	}
+}
+
+func TestDecoderFetchTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	d := NewDecoder(srv.URL, FetchTimeout(100*time.Millisecond))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+	token.Header["kid"] = "unknown"
+	s, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err = d.Decode(s); err == nil {
+		t.Fatal("decode should fail when keys can't be fetched")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("fetch should time out, took %v", elapsed)
+	}
+}
@@ -0,0 +1,58 @@
+package jwt
+
+import (
+	"net/http"
+	"time"
+)
+
+type Option interface {
+	apply(*Decoder)
+}
+
+type optionFunc func(*Decoder)
+
+func (f optionFunc) apply(d *Decoder) {
+	f(d)
+}
+
+// Issuers 设置允许的签发者(iss), 为空时不校验
+func Issuers(iss ...string) Option {
+	return optionFunc(func(d *Decoder) {
+		d.issuers = iss
+	})
+}
+
+// Audiences 设置允许的受众(aud), 通常为应用的 client id, 为空时不校验
+func Audiences(aud ...string) Option {
+	return optionFunc(func(d *Decoder) {
+		d.audiences = aud
+	})
+}
+
+// Leeway 设置校验 exp/nbf/iat 时允许的时钟偏差
+func Leeway(leeway time.Duration) Option {
+	return optionFunc(func(d *Decoder) {
+		d.leeway = leeway
+	})
+}
+
+// HTTPClient 设置获取公钥使用的 http client
+func HTTPClient(client *http.Client) Option {
+	return optionFunc(func(d *Decoder) {
+		d.client = client
+	})
+}
+
+// RefreshInterval 设置遇到未知 kid 时两次拉取公钥的最小间隔
+func RefreshInterval(interval time.Duration) Option {
+	return optionFunc(func(d *Decoder) {
+		d.refreshInterval = interval
+	})
+}
+
+// FetchTimeout 设置拉取公钥的超时时间
+func FetchTimeout(timeout time.Duration) Option {
+	return optionFunc(func(d *Decoder) {
+		d.fetchTimeout = timeout
+	})
+}
@@ -0,0 +1,375 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/dmzlingyin/utils/cache"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+
+	sessionKeyPrefix = "session:"
+	usedSuffix       = ":used"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("session: invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("session: refresh token reused")
+	ErrSessionRevoked      = errors.New("session: revoked")
+)
+
+// SigningKey 签发 access token 的密钥, HS256 使用 []byte, RS256 使用 *rsa.PrivateKey, ES256 使用 *ecdsa.PrivateKey
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    any
+}
+
+// verifyKey 返回验证签名使用的密钥
+func (k *SigningKey) verifyKey() (any, error) {
+	switch key := k.Key.(type) {
+	case []byte:
+		if _, ok := k.Method.(*jwt.SigningMethodHMAC); ok {
+			return key, nil
+		}
+	case *rsa.PrivateKey:
+		if _, ok := k.Method.(*jwt.SigningMethodRSA); ok {
+			return &key.PublicKey, nil
+		}
+	case *ecdsa.PrivateKey:
+		if _, ok := k.Method.(*jwt.SigningMethodECDSA); ok {
+			return &key.PublicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("session: key type %T doesn't match method %s", k.Key, k.Method.Alg())
+}
+
+type SessionConfig struct {
+	Issuer     string
+	Audience   string
+	AccessTTL  time.Duration // 默认 15 分钟
+	RefreshTTL time.Duration // 默认 30 天
+}
+
+// SessionClaims 自有 access token 的声明
+type SessionClaims struct {
+	jwt.StandardClaims
+	SessionID string         `json:"sid"`           // 同一次登录刷新出的 token 属于同一个会话
+	DeviceID  string         `json:"did,omitempty"` // 设备ID
+	UserGen   int64          `json:"ugen,omitempty"`
+	DeviceGen int64          `json:"dgen,omitempty"`
+	Extra     map[string]any `json:"ext,omitempty"`
+}
+
+// Session 一次签发的 token 对
+type Session struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// refreshRecord refresh token 在缓存中的记录, 只保存 token 的哈希
+type refreshRecord struct {
+	UserID    string         `json:"uid"`
+	DeviceID  string         `json:"did"`
+	SessionID string         `json:"sid"`
+	Extra     map[string]any `json:"ext"`
+	UserGen   int64          `json:"ugen"`
+	DeviceGen int64          `json:"dgen"`
+	ExpiresAt int64          `json:"exp"`
+}
+
+// Issuer 签发并校验自有的 access token 和 refresh token
+type Issuer struct {
+	cfg   SessionConfig
+	store cache.Cache
+
+	mu      sync.RWMutex
+	current *SigningKey
+	keys    map[string]*SigningKey
+}
+
+func NewIssuer(store cache.Cache, key *SigningKey, cfg SessionConfig) (*Issuer, error) {
+	if cfg.AccessTTL <= 0 {
+		cfg.AccessTTL = DefaultAccessTTL
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = DefaultRefreshTTL
+	}
+	i := &Issuer{
+		cfg:   cfg,
+		store: store,
+		keys:  make(map[string]*SigningKey),
+	}
+	if err := i.RotateKey(key); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// RotateKey 使用新的密钥签发, 旧密钥保留用于验证未过期的 token
+func (i *Issuer) RotateKey(key *SigningKey) error {
+	if key == nil || key.ID == "" || key.Method == nil {
+		return errors.New("session: invalid signing key")
+	}
+	if _, err := key.verifyKey(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.current = key
+	i.keys[key.ID] = key
+	return nil
+}
+
+// RemoveKey 移除不再用于验证的旧密钥, 不能移除当前密钥
+func (i *Issuer) RemoveKey(kid string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.current.ID != kid {
+		delete(i.keys, kid)
+	}
+}
+
+// Issue 登录成功后签发新的会话
+func (i *Issuer) Issue(ctx context.Context, userID, deviceID string, extra map[string]any) (*Session, error) {
+	sid, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	ugen, dgen, err := i.generations(ctx, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return i.issue(ctx, &refreshRecord{
+		UserID:    userID,
+		DeviceID:  deviceID,
+		SessionID: sid,
+		Extra:     extra,
+		UserGen:   ugen,
+		DeviceGen: dgen,
+	})
+}
+
+// issue 使用 rec 中的版本号签发, 刷新时沿用登录时的版本号, 撤销后刷新得到的 token 同样无效
+func (i *Issuer) issue(ctx context.Context, rec *refreshRecord) (*Session, error) {
+	now := time.Now()
+	i.mu.RLock()
+	key := i.current
+	i.mu.RUnlock()
+	claims := &SessionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  i.cfg.Audience,
+			ExpiresAt: now.Add(i.cfg.AccessTTL).Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    i.cfg.Issuer,
+			Subject:   rec.UserID,
+		},
+		SessionID: rec.SessionID,
+		DeviceID:  rec.DeviceID,
+		UserGen:   rec.UserGen,
+		DeviceGen: rec.DeviceGen,
+		Extra:     rec.Extra,
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	access, err := token.SignedString(key.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	refreshExpiry := now.Add(i.cfg.RefreshTTL)
+	record := refreshRecord{
+		UserID:    rec.UserID,
+		DeviceID:  rec.DeviceID,
+		SessionID: rec.SessionID,
+		Extra:     rec.Extra,
+		UserGen:   rec.UserGen,
+		DeviceGen: rec.DeviceGen,
+		ExpiresAt: refreshExpiry.Unix(),
+	}
+	if err = i.store.SetWithTTL(ctx, refreshKey(refresh), record, i.cfg.RefreshTTL); err != nil {
+		return nil, err
+	}
+	return &Session{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		ExpiresAt:        time.Unix(claims.ExpiresAt, 0),
+		RefreshExpiresAt: refreshExpiry,
+	}, nil
+}
+
+// Verify 校验 access token 的签名、有效期及是否已被撤销
+func (i *Issuer) Verify(ctx context.Context, accessToken string) (*SessionClaims, error) {
+	t, err := jwt.ParseWithClaims(accessToken, &SessionClaims{}, i.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := t.Claims.(*SessionClaims)
+	if !ok || !t.Valid {
+		return nil, errors.New("session: invalid token")
+	}
+	if i.cfg.Issuer != "" && claims.Issuer != i.cfg.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if i.cfg.Audience != "" && claims.Audience != i.cfg.Audience {
+		return nil, ErrInvalidAudience
+	}
+
+	if revoked, err := i.store.Exists(ctx, familyKey(claims.SessionID)); err != nil {
+		return nil, err
+	} else if revoked {
+		return nil, ErrSessionRevoked
+	}
+	ugen, dgen, err := i.generations(ctx, claims.Subject, claims.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserGen != ugen || claims.DeviceGen != dgen {
+		return nil, ErrSessionRevoked
+	}
+	return claims, nil
+}
+
+func (i *Issuer) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	i.mu.RLock()
+	key, ok := i.keys[kid]
+	i.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	// 只接受与密钥一致的签名算法
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("session: unexpected signing method %s", t.Method.Alg())
+	}
+	return key.verifyKey()
+}
+
+// Refresh 使用 refresh token 换取新的 token 对, 旧的 refresh token 随即失效,
+// 再次使用已失效的 refresh token 会撤销整个会话
+func (i *Issuer) Refresh(ctx context.Context, refreshToken string) (*Session, error) {
+	key := refreshKey(refreshToken)
+	var rec refreshRecord
+	if err := i.store.Scan(ctx, key, &rec); errors.Is(err, cache.ErrKeyNotFound) {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+	ttl := time.Until(time.Unix(rec.ExpiresAt, 0))
+	if ttl <= 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if revoked, err := i.store.Exists(ctx, familyKey(rec.SessionID)); err != nil {
+		return nil, err
+	} else if revoked {
+		return nil, ErrSessionRevoked
+	}
+	ugen, dgen, err := i.generations(ctx, rec.UserID, rec.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if rec.UserGen != ugen || rec.DeviceGen != dgen {
+		return nil, ErrSessionRevoked
+	}
+
+	// 原子地标记为已使用, 保留记录以便检测重复使用, 并发刷新时只有一个请求能通过
+	n, err := i.store.Incr(ctx, key+usedSuffix, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if n != 1 {
+		// refresh token 可能已泄露, 撤销整个会话
+		if err = i.RevokeSession(ctx, rec.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return i.issue(ctx, &rec)
+}
+
+// RevokeSession 撤销一次登录产生的所有 token
+func (i *Issuer) RevokeSession(ctx context.Context, sessionID string) error {
+	return i.store.SetWithTTL(ctx, familyKey(sessionID), true, i.cfg.RefreshTTL)
+}
+
+// RevokeUser 撤销用户在所有设备上的会话, 例如修改密码或注销账号
+func (i *Issuer) RevokeUser(ctx context.Context, userID string) error {
+	return i.bumpGeneration(ctx, genKey(userID, ""))
+}
+
+// RevokeDevice 撤销用户在指定设备上的会话
+func (i *Issuer) RevokeDevice(ctx context.Context, userID, deviceID string) error {
+	if deviceID == "" {
+		return errors.New("session: device id is empty")
+	}
+	return i.bumpGeneration(ctx, genKey(userID, deviceID))
+}
+
+// generations 用户和设备的撤销版本号, 撤销时递增, 版本号不一致的 token 视为已撤销
+func (i *Issuer) generations(ctx context.Context, userID, deviceID string) (ugen, dgen int64, err error) {
+	if ugen, err = i.generation(ctx, genKey(userID, "")); err != nil {
+		return
+	}
+	if deviceID != "" {
+		dgen, err = i.generation(ctx, genKey(userID, deviceID))
+	}
+	return
+}
+
+func (i *Issuer) generation(ctx context.Context, key string) (int64, error) {
+	var gen int64
+	err := i.store.Scan(ctx, key, &gen)
+	if errors.Is(err, cache.ErrKeyNotFound) {
+		return 0, nil
+	}
+	return gen, err
+}
+
+// bumpGeneration 原子递增, 并发撤销时不会丢失; 不过期, 否则已撤销的 token 会重新生效
+func (i *Issuer) bumpGeneration(ctx context.Context, key string) error {
+	_, err := i.store.Incr(ctx, key, 0)
+	return err
+}
+
+func refreshKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return sessionKeyPrefix + "refresh:" + hex.EncodeToString(sum[:])
+}
+
+func familyKey(sessionID string) string {
+	return sessionKeyPrefix + "revoked:" + sessionID
+}
+
+func genKey(userID, deviceID string) string {
+	if deviceID == "" {
+		return sessionKeyPrefix + "gen:" + userID
+	}
+	return sessionKeyPrefix + "gen:" + userID + ":" + deviceID
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,157 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/dmzlingyin/utils/cache"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestIssuer(t *testing.T) *Issuer {
+	issuer, err := NewIssuer(cache.NewMemory(0, 0), &SigningKey{ID: "k1", Method: jwt.SigningMethodHS256, Key: []byte("secret")}, SessionConfig{
+		Issuer:   "utils",
+		Audience: "app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+func TestIssuer(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+
+	s1, err := issuer.Issue(ctx, "u1", "d1", map[string]any{"role": "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := issuer.Verify(ctx, s1.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "u1" || claims.DeviceID != "d1" || claims.Extra["role"] != "admin" {
+		t.Fatalf("invalid claims: %+v", claims)
+	}
+
+	// 轮换密钥后旧 token 仍然有效
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err = issuer.RotateKey(&SigningKey{ID: "k2", Method: jwt.SigningMethodES256, Key: ecKey}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = issuer.Verify(ctx, s1.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+
+	s2, err := issuer.Refresh(ctx, s1.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = issuer.Verify(ctx, s2.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	// 重复使用旧的 refresh token 会撤销整个会话
+	if _, err = issuer.Refresh(ctx, s1.RefreshToken); err != ErrRefreshTokenReused {
+		t.Fatal("reused refresh token should be detected")
+	}
+	if _, err = issuer.Verify(ctx, s2.AccessToken); err != ErrSessionRevoked {
+		t.Fatal("session should be revoked")
+	}
+	if _, err = issuer.Refresh(ctx, s2.RefreshToken); err != ErrSessionRevoked {
+		t.Fatal("session should be revoked")
+	}
+
+	// 撤销设备只影响该设备
+	s3, _ := issuer.Issue(ctx, "u1", "d1", nil)
+	s4, _ := issuer.Issue(ctx, "u1", "d2", nil)
+	if err = issuer.RevokeDevice(ctx, "u1", "d1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = issuer.Verify(ctx, s3.AccessToken); err != ErrSessionRevoked {
+		t.Fatal("device should be revoked")
+	}
+	if _, err = issuer.Verify(ctx, s4.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	// 撤销后重新登录的 token 有效
+	s5, _ := issuer.Issue(ctx, "u1", "d1", nil)
+	if _, err = issuer.Verify(ctx, s5.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if err = issuer.RevokeUser(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = issuer.Verify(ctx, s4.AccessToken); err != ErrSessionRevoked {
+		t.Fatal("user should be revoked")
+	}
+}
+
+// 撤销前签发的 refresh token 不能换取新的会话
+func TestRefreshAfterRevoke(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+
+	s1, _ := issuer.Issue(ctx, "u1", "d1", nil)
+	s2, _ := issuer.Issue(ctx, "u1", "d2", nil)
+	if err := issuer.RevokeDevice(ctx, "u1", "d1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Refresh(ctx, s1.RefreshToken); err != ErrSessionRevoked {
+		t.Fatalf("device should be revoked, got %v", err)
+	}
+	if _, err := issuer.Refresh(ctx, s2.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	s3, _ := issuer.Issue(ctx, "u1", "d2", nil)
+	if err := issuer.RevokeUser(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Refresh(ctx, s3.RefreshToken); err != ErrSessionRevoked {
+		t.Fatalf("user should be revoked, got %v", err)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	s, _ := issuer.Issue(ctx, "u1", "d1", nil)
+
+	var wg sync.WaitGroup
+	var success, reused atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := issuer.Refresh(ctx, s.RefreshToken)
+			switch err {
+			case nil:
+				success.Add(1)
+			case ErrRefreshTokenReused:
+				reused.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if success.Load() != 1 || reused.Load() == 0 {
+		t.Fatalf("success %d, reused %d", success.Load(), reused.Load())
+	}
+
+	// 并发撤销不会丢失递增
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = issuer.RevokeUser(ctx, "u2")
+		}()
+	}
+	wg.Wait()
+	if gen, _ := issuer.generation(ctx, genKey("u2", "")); gen != 10 {
+		t.Fatalf("generation should be 10, got %d", gen)
+	}
+}
@@ -0,0 +1,127 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/oauth2"
+	"net/url"
+)
+
+const (
+	LineAuthURL   = "https://access.line.me/oauth2/v2.1/authorize"
+	LineTokenURL  = "https://api.line.me/oauth2/v2.1/token"
+	LineVerifyURL = "https://api.line.me/oauth2/v2.1/verify"
+	LineRevokeURL = "https://api.line.me/oauth2/v2.1/revoke"
+)
+
+const (
+	LineScopeOpenID  = "openid"
+	LineScopeProfile = "profile"
+	LineScopeEmail   = "email"
+)
+
+func NewLine() Provider {
+	return must(NewLineWith(configOptions("oauth2.line")...))
+}
+
+func NewLineWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts, LineScopeOpenID, LineScopeProfile, LineScopeEmail)
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL:   LineAuthURL,
+		TokenURL:  LineTokenURL,
+		UserURL:   LineVerifyURL,
+		RevokeURL: LineRevokeURL,
+	})
+	return &line{
+		cfg: o.oauth2Config(ep.AuthURL, ep.TokenURL),
+		ep:  ep,
+	}, nil
+}
+
+type line struct {
+	cfg *oauth2.Config
+	ep  Endpoints
+}
+
+func (l *line) AuthCodeURL(state, verifier, redirect string) string {
+	var opts []oauth2.AuthCodeOption
+	if verifier != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", oidcNonce(verifier)))
+	}
+	return authCodeURL(l.cfg, state, verifier, redirect, true, opts...)
+}
+
+// Authorize 支持 code 和客户端 SDK 获取的 ID token 两种方式
+func (l *line) Authorize(ctx context.Context, args *AuthArgs) (*oauth2.Token, *User, error) {
+	if args.Token != "" {
+		user, err := l.verify(ctx, args.Token, args.Nonce)
+		if err != nil {
+			return nil, nil, err
+		}
+		token := &oauth2.Token{TokenType: "Bearer"}
+		return token.WithExtra(map[string]any{"id_token": args.Token}), user, nil
+	}
+
+	token, err := l.cfg.Exchange(ctx, args.Code, exchangeOptions(args, true)...)
+	if err != nil {
+		return nil, nil, err
+	} else if !token.Valid() {
+		return nil, nil, errors.New("invalid token")
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, nil, errors.New("id_token not found")
+	}
+	var nonce string
+	if args.Verifier != "" {
+		nonce = oidcNonce(args.Verifier)
+	}
+	user, err := l.verify(ctx, idToken, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, user, nil
+}
+
+// verify 通过 LINE 的校验接口验证 ID token 的签名、受众和有效期
+func (l *line) verify(ctx context.Context, idToken, nonce string) (*User, error) {
+	v := url.Values{}
+	v.Set("id_token", idToken)
+	v.Set("client_id", l.cfg.ClientID)
+	if nonce != "" {
+		v.Set("nonce", nonce)
+	}
+	var r struct {
+		Sub              string `json:"sub"`
+		Name             string `json:"name"`
+		Picture          string `json:"picture"`
+		Email            string `json:"email"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := postForm(ctx, l.ep.UserURL, v, &r); err != nil {
+		return nil, err
+	}
+	if r.Error != "" {
+		return nil, errors.New(r.ErrorDescription)
+	}
+	return &User{
+		ID:       r.Sub,
+		Username: r.Name,
+		Avatar:   r.Picture,
+		Email:    r.Email,
+	}, nil
+}
+
+func (l *line) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return refreshWithConfig(ctx, l.cfg, refreshToken)
+}
+
+// Revoke LINE 只能撤销 access token
+func (l *line) Revoke(ctx context.Context, token string) error {
+	form := url.Values{}
+	form.Set("client_id", l.cfg.ClientID)
+	form.Set("client_secret", l.cfg.ClientSecret)
+	form.Set("access_token", token)
+	return revokeToken(ctx, l.ep.RevokeURL, form, "", "")
+}
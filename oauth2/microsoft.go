@@ -0,0 +1,104 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dmzlingyin/utils/config"
+	"golang.org/x/oauth2"
+	"net/http"
+)
+
+const (
+	MicrosoftAuthURL  = "https://login.microsoftonline.com/%s/oauth2/v2.0/authorize"
+	MicrosoftTokenURL = "https://login.microsoftonline.com/%s/oauth2/v2.0/token"
+	MicrosoftUserURL  = "https://graph.microsoft.com/v1.0/me"
+
+	// MicrosoftTenantCommon 允许任意组织账号和个人账号登录
+	MicrosoftTenantCommon = "common"
+)
+
+const (
+	MicrosoftScopeOpenID   = "openid"
+	MicrosoftScopeProfile  = "profile"
+	MicrosoftScopeEmail    = "email"
+	MicrosoftScopeUserRead = "User.Read"
+	MicrosoftScopeOffline  = "offline_access"
+)
+
+func NewMicrosoft() Provider {
+	opts := append(configOptions("oauth2.microsoft"), Tenant(config.GetString("oauth2.microsoft.tenant")))
+	return must(NewMicrosoftWith(opts...))
+}
+
+func NewMicrosoftWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts, MicrosoftScopeOpenID, MicrosoftScopeProfile, MicrosoftScopeEmail, MicrosoftScopeUserRead, MicrosoftScopeOffline)
+	if o.tenant == "" {
+		o.tenant = MicrosoftTenantCommon
+	}
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL:  fmt.Sprintf(MicrosoftAuthURL, o.tenant),
+		TokenURL: fmt.Sprintf(MicrosoftTokenURL, o.tenant),
+		UserURL:  MicrosoftUserURL,
+	})
+	return &microsoft{
+		cfg: o.oauth2Config(ep.AuthURL, ep.TokenURL),
+		ep:  ep,
+	}, nil
+}
+
+type microsoft struct {
+	cfg *oauth2.Config
+	ep  Endpoints
+}
+
+func (m *microsoft) AuthCodeURL(state, verifier, redirect string) string {
+	return authCodeURL(m.cfg, state, verifier, redirect, true)
+}
+
+func (m *microsoft) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
+	token, err = m.cfg.Exchange(ctx, args.Code, exchangeOptions(args, true)...)
+	if err != nil {
+		return
+	} else if !token.Valid() {
+		err = errors.New("invalid token")
+		return
+	}
+
+	// 多租户下 id_token 的签发者随租户变化, 直接通过 Graph 获取用户信息
+	res, err := m.cfg.Client(ctx, token).Get(m.ep.UserURL)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("microsoft graph error, status: %d", res.StatusCode)
+	}
+
+	var u struct {
+		ID                string `json:"id"`
+		DisplayName       string `json:"displayName"`
+		Mail              string `json:"mail"`
+		UserPrincipalName string `json:"userPrincipalName"`
+		MobilePhone       string `json:"mobilePhone"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&u); err != nil {
+		return nil, nil, err
+	}
+	// UPN 由租户管理员设置, 不一定是可以收信的邮箱, 不能作为 Email 使用
+	username := u.DisplayName
+	if username == "" {
+		username = u.UserPrincipalName
+	}
+	return token, &User{
+		ID:       u.ID,
+		Username: username,
+		Email:    u.Mail,
+		Phone:    u.MobilePhone,
+	}, nil
+}
+
+func (m *microsoft) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return refreshWithConfig(ctx, m.cfg, refreshToken)
+}
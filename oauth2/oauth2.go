@@ -2,21 +2,37 @@ package oauth2
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/dmzlingyin/utils/cache"
+	"github.com/dmzlingyin/utils/config"
 	"golang.org/x/oauth2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 )
 
 type OauthType string
 
 const (
-	TypeGoogle   OauthType = "google"
-	TypeApple    OauthType = "apple"
-	TypeFacebook OauthType = "facebook"
-	TypeDiscord  OauthType = "discord"
-	TypeTwitter  OauthType = "twitter"
-	TypeWechat   OauthType = "wechat"
-	TypeCasdoor  OauthType = "casdoor"
+	TypeGoogle     OauthType = "google"
+	TypeApple      OauthType = "apple"
+	TypeFacebook   OauthType = "facebook"
+	TypeDiscord    OauthType = "discord"
+	TypeTwitter    OauthType = "twitter"
+	TypeWechat     OauthType = "wechat"
+	TypeWechatMini OauthType = "wechat_mini"
+	TypeCasdoor    OauthType = "casdoor"
+	TypeQQ         OauthType = "qq"
+	TypeWeibo      OauthType = "weibo"
+	TypeAlipay     OauthType = "alipay"
+	TypeDouyin     OauthType = "douyin"
+	TypeGithub     OauthType = "github"
+	TypeMicrosoft  OauthType = "microsoft"
+	TypeLine       OauthType = "line"
 )
 
 type User struct {
@@ -25,6 +41,9 @@ type User struct {
 	Avatar   string // 头像
 	Email    string // 邮箱
 	Phone    string // 手机
+	UnionID  string // 同一开放平台主体下的统一ID(微信)
+	// EmailVerified 第三方平台已确认邮箱属于该用户, 只有为 true 时才能按邮箱合并账号
+	EmailVerified bool
 }
 
 type AuthArgs struct {
@@ -32,12 +51,19 @@ type AuthArgs struct {
 	Type OauthType
 	// 授权码
 	Code string
-	// 随机值, 防止 XSRF 攻击
+	// 随机值, 防止 XSRF 攻击. 授权码登录必须传递 AuthCodeURL 生成的 state, 见 Client.AllowStateless
 	State string
 	// 客户端可以直接传递token, 省略了code换取token的步骤
+	// Google/Apple 为 ID token, Facebook 为 access token
 	Token string
+	// 客户端获取 ID token 时使用的 nonce, 不为空时校验
+	Nonce string
 	// 如果微信登录要获取手机号,需多传一个code
 	PCode string
+	// PKCE 校验码, 由 Client 根据 State 填充
+	Verifier string
+	// 生成授权链接时使用的回调地址, 由 Client 根据 State 填充
+	RedirectURL string
 }
 
 type Builder func() Provider
@@ -46,32 +72,126 @@ type Provider interface {
 	Authorize(ctx context.Context, args *AuthArgs) (*oauth2.Token, *User, error)
 }
 
-func New(ots ...OauthType) Provider {
+// URLBuilder 支持生成授权跳转链接的登录方式, 不支持 PKCE 的平台忽略 verifier
+type URLBuilder interface {
+	AuthCodeURL(state, verifier, redirect string) string
+}
+
+// Registration 注册到 Client 的登录方式, 可以是 OauthType(从全局配置构建)或 WithProvider
+type Registration interface {
+	registerTo(c *Client)
+}
+
+func (ot OauthType) registerTo(c *Client) {
+	if builder, ok := c.builders[ot]; ok {
+		c.register(ot, builder())
+	}
+}
+
+// WithProvider 注册预先构建的登录方式, 例如通过 NewAppleWith 创建的多个 Apple 应用
+func WithProvider(ot OauthType, p Provider) Registration {
+	return providerRegistration{ot: ot, p: p}
+}
+
+type providerRegistration struct {
+	ot OauthType
+	p  Provider
+}
+
+func (r providerRegistration) registerTo(c *Client) {
+	c.register(r.ot, r.p)
+}
+
+func New(regs ...Registration) *Client {
 	c := &Client{
+		states:    cache.NewMemory(DefaultStateTTL, time.Minute),
+		stateTTL:  DefaultStateTTL,
+		stateless: map[OauthType]bool{TypeWechatMini: true},
 		providers: make(map[OauthType]Provider),
 		builders: map[OauthType]Builder{
-			TypeGoogle:   NewGoogle,
-			TypeApple:    NewApple,
-			TypeFacebook: NewFacebook,
-			TypeDiscord:  NewDiscord,
-			TypeTwitter:  NewTwitter,
-			TypeWechat:   NewWechat,
-			TypeCasdoor:  NewCasdoor,
+			TypeGoogle:     NewGoogle,
+			TypeApple:      NewApple,
+			TypeFacebook:   NewFacebook,
+			TypeDiscord:    NewDiscord,
+			TypeTwitter:    NewTwitter,
+			TypeWechat:     NewWechat,
+			TypeWechatMini: NewWechatMini,
+			TypeCasdoor:    NewCasdoor,
+			TypeQQ:         NewQQ,
+			TypeWeibo:      NewWeibo,
+			TypeAlipay:     NewAlipay,
+			TypeDouyin:     NewDouyin,
+			TypeGithub:     NewGithub,
+			TypeMicrosoft:  NewMicrosoft,
+			TypeLine:       NewLine,
 		},
 	}
-	for _, ot := range ots {
-		if builder, ok := c.builders[ot]; ok {
-			c.register(ot, builder())
-		}
+	for _, r := range regs {
+		r.registerTo(c)
 	}
 	return c
 }
 
 type Client struct {
+	states    cache.Cache
+	stateTTL  time.Duration
+	stateless map[OauthType]bool
 	providers map[OauthType]Provider
 	builders  map[OauthType]Builder
 }
 
+// Register 注册自定义的登录方式, 例如通过 NewOIDC 接入的企业身份提供方
+func (c *Client) Register(ot OauthType, p Provider) {
+	c.register(ot, p)
+}
+
+// getJSON 请求第三方接口并解析 JSON 响应
+func getJSON(ctx context.Context, addr string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(req, v)
+}
+
+// postForm 以表单方式请求第三方接口并解析 JSON 响应
+func postForm(ctx context.Context, addr string, form url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doJSON(req, v)
+}
+
+func doJSON(req *http.Request, v any) error {
+	resp, err := httpClient(req.Context()).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("request %s error, status: %d", req.URL.Host, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// httpClient 优先使用通过 oauth2.HTTPClient 注入到 ctx 中的 client, 与 Exchange 保持一致
+func httpClient(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && c != nil {
+		return c
+	}
+	return http.DefaultClient
+}
+
+// configStrings 读取字符串数组配置, 并去掉空值
+func configStrings(field string, values ...string) []string {
+	for _, v := range config.Get(field).Array() {
+		values = append(values, v.String())
+	}
+	return slices.DeleteFunc(values, func(v string) bool { return v == "" })
+}
+
 func (c *Client) register(ot OauthType, p Provider) {
 	if _, ok := c.providers[ot]; ok {
 		panic("duplicate provider: " + ot)
@@ -81,7 +201,12 @@ func (c *Client) register(ot OauthType, p Provider) {
 
 func (c *Client) Authorize(ctx context.Context, args *AuthArgs) (*oauth2.Token, *User, error) {
 	if p, ok := c.providers[args.Type]; ok {
-		return p.Authorize(ctx, args)
+		// 复制一份, 避免修改调用方的参数
+		a := *args
+		if err := c.checkState(ctx, p, &a); err != nil {
+			return nil, nil, err
+		}
+		return p.Authorize(ctx, &a)
 	}
 	return nil, nil, errors.New(fmt.Sprintf("not supported oauth type: %s", args.Type))
 }
@@ -3,6 +3,7 @@ package oauth2
 import (
 	"context"
 	"github.com/dmzlingyin/utils/config"
+	"strings"
 	"testing"
 )
 
@@ -33,3 +34,35 @@ func TestWechat(t *testing.T) {
 	}
 	t.Log(token, user)
 }
+
+func TestWithProvider(t *testing.T) {
+	if _, err := NewWechatWith(ClientID("appid")); err == nil {
+		t.Fatal("expected error for empty secret")
+	}
+	// 密钥和证书没有默认路径, 缺少时返回错误
+	if _, err := NewAppleWith(ClientID("com.example.web")); err == nil {
+		t.Fatal("expected error for empty apple key")
+	}
+	if _, err := NewCasdoorWith(CasdoorApp("https://door.example.com", "org", "app", nil)); err == nil {
+		t.Fatal("expected error for empty casdoor certificate")
+	}
+
+	a, err := NewGoogleWith(ClientID("app-a"), ClientSecret("secret"), RedirectURL("https://a.example.com/cb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewGoogleWith(ClientID("app-b"), ClientSecret("secret"), RedirectURL("https://b.example.com/cb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(WithProvider(TypeGoogle, a), WithProvider("google_b", b))
+	for ot, id := range map[OauthType]string{TypeGoogle: "app-a", "google_b": "app-b"} {
+		u, err := c.AuthCodeURL(context.Background(), ot, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(u, "client_id="+id) {
+			t.Fatalf("unexpected auth url for %s: %s", ot, u)
+		}
+	}
+}
@@ -0,0 +1,867 @@
+// Package oauthtest 进程内的 OAuth2/OIDC 授权服务器, 用于离线测试各登录方式的完整流程
+package oauthtest
+
+import (
+	"cmp"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/dmzlingyin/utils/oauth2"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KeyIDRSA = "oauthtest-rsa"
+	KeyIDEC  = "oauthtest-ec"
+
+	// TokenTTL access token 及 ID token 的有效期
+	TokenTTL = time.Hour
+)
+
+// User 测试服务器中的用户, Subject 为用户ID, GitHub 要求为数字
+type User struct {
+	Subject  string
+	Name     string
+	Username string
+	Email    string
+	Picture  string
+	Phone    string
+	// EmailVerified 返回给 Google/Apple/GitHub/OIDC 的邮箱验证状态
+	EmailVerified bool
+}
+
+type Server struct {
+	// URL 服务器地址, 同时作为 ID token 的 issuer
+	URL string
+
+	srv    *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu      sync.Mutex
+	alg     string
+	users   []User
+	codes   map[string]*grant
+	access  map[string]*grant
+	refresh map[string]*grant
+}
+
+// grant 一次授权的上下文, 授权码、access token 和 refresh token 共享
+type grant struct {
+	user      User
+	clientID  string
+	redirect  string
+	challenge string
+	method    string
+	nonce     string
+	scope     string
+}
+
+// NewServer 启动测试服务器, 使用完毕后需调用 Close
+func NewServer(users ...User) *Server {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		rsaKey:  rsaKey,
+		ecKey:   ecKey,
+		alg:     jwt.SigningMethodRS256.Alg(),
+		users:   users,
+		codes:   make(map[string]*grant),
+		access:  make(map[string]*grant),
+		refresh: make(map[string]*grant),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("GET /jwks", s.handleJWKS)
+	mux.HandleFunc("GET /authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /token", s.handleToken)
+	mux.HandleFunc("POST /revoke", s.handleRevoke)
+	mux.HandleFunc("GET /userinfo", s.handleUserinfo)
+	mux.HandleFunc("GET /github/user", s.handleGithubUser)
+	mux.HandleFunc("GET /github/user/emails", s.handleGithubEmails)
+	mux.HandleFunc("GET /discord/users/@me", s.handleDiscordUser)
+	mux.HandleFunc("GET /microsoft/me", s.handleMicrosoftUser)
+	mux.HandleFunc("GET /facebook/me", s.handleFacebookUser)
+	mux.HandleFunc("GET /twitter/users/me", s.handleTwitterUser)
+	mux.HandleFunc("POST /line/verify", s.handleLineVerify)
+	mux.HandleFunc("GET /facebook/debug_token", s.handleFacebookDebug)
+	mux.HandleFunc("GET /qq/me", s.handleQQMe)
+	mux.HandleFunc("GET /qq/user/get_user_info", s.handleQQUser)
+	mux.HandleFunc("GET /weibo/users/show.json", s.handleWeiboUser)
+	mux.HandleFunc("POST /douyin/oauth/access_token", s.handleDouyinToken)
+	mux.HandleFunc("POST /douyin/oauth/userinfo", s.handleDouyinUser)
+	mux.HandleFunc("GET /wechat/sns/oauth2/access_token", s.handleWechatToken)
+	mux.HandleFunc("GET /wechat/sns/userinfo", s.handleWechatUser)
+	mux.HandleFunc("POST /casdoor/api/login/oauth/access_token", s.handleCasdoorToken)
+	mux.HandleFunc("POST /alipay/gateway.do", s.handleAlipay)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// AddUser 添加用户, Subject 相同时覆盖
+func (s *Server) AddUser(u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.users {
+		if s.users[i].Subject == u.Subject {
+			s.users[i] = u
+			return
+		}
+	}
+	s.users = append(s.users, u)
+}
+
+// SetAlgorithm 设置 ID token 的签名算法, 支持 RS256 和 ES256
+func (s *Server) SetAlgorithm(alg string) error {
+	if alg != jwt.SigningMethodRS256.Alg() && alg != jwt.SigningMethodES256.Alg() {
+		return fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+	s.mu.Lock()
+	s.alg = alg
+	s.mu.Unlock()
+	return nil
+}
+
+// Endpoints 返回指定登录方式使用的接口地址, 配合 oauth2.OverrideEndpoints 使用
+func (s *Server) Endpoints(ot oauth2.OauthType) oauth2.Endpoints {
+	userPaths := map[oauth2.OauthType]string{
+		oauth2.TypeGithub:    "/github/user",
+		oauth2.TypeDiscord:   "/discord/users/@me",
+		oauth2.TypeMicrosoft: "/microsoft/me",
+		oauth2.TypeFacebook:  "/facebook/me",
+		oauth2.TypeTwitter:   "/twitter/users/me",
+		oauth2.TypeLine:      "/line/verify",
+		oauth2.TypeQQ:        "/qq/user/get_user_info",
+		oauth2.TypeWeibo:     "/weibo/users/show.json",
+		oauth2.TypeDouyin:    "/douyin/oauth/userinfo",
+	}
+	userPath, ok := userPaths[ot]
+	if !ok {
+		userPath = "/userinfo"
+	}
+	ep := oauth2.Endpoints{
+		AuthURL:   s.URL + "/authorize",
+		TokenURL:  s.URL + "/token",
+		UserURL:   s.URL + userPath,
+		KeyURL:    s.URL + "/jwks",
+		RevokeURL: s.URL + "/revoke",
+		Issuer:    s.URL,
+	}
+	switch ot {
+	case oauth2.TypeFacebook:
+		ep.TokenInfoURL = s.URL + "/facebook/debug_token"
+	case oauth2.TypeQQ:
+		ep.TokenInfoURL = s.URL + "/qq/me"
+	case oauth2.TypeDouyin:
+		ep.TokenURL = s.URL + "/douyin/oauth/access_token"
+	case oauth2.TypeWechat, oauth2.TypeWechatMini:
+		ep.APIURL = s.URL + "/wechat"
+	case oauth2.TypeCasdoor:
+		ep.APIURL = s.URL + "/casdoor"
+	case oauth2.TypeAlipay:
+		ep.APIURL = s.URL + "/alipay/gateway.do"
+	}
+	return ep
+}
+
+// PublicKey 返回 RS256 签名公钥(PEM), 用作支付宝公钥及 Casdoor 证书
+func (s *Server) PublicKey() []byte {
+	der, err := x509.MarshalPKIXPublicKey(&s.rsaKey.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// Login 模拟用户在授权页面同意授权, 返回回调中的 code 和 state
+func (s *Server) Login(authURL, subject string) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	q.Set("login_hint", subject)
+	u.RawQuery = q.Encode()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return "", "", fmt.Errorf("authorize error, status: %d", resp.StatusCode)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", "", err
+	}
+	if e := loc.Query().Get("error"); e != "" {
+		return "", "", errors.New(e)
+	}
+	return cmp.Or(loc.Query().Get("code"), loc.Query().Get("auth_code")), loc.Query().Get("state"), nil
+}
+
+// IDToken 为用户签发 ID token, 用于测试客户端直接传递 ID token 的登录方式
+func (s *Server) IDToken(clientID, subject, nonce string) (string, error) {
+	user, ok := s.findUser(subject)
+	if !ok {
+		return "", fmt.Errorf("user not found: %s", subject)
+	}
+	return s.signIDToken(&grant{user: user, clientID: clientID, nonce: nonce})
+}
+
+// AccessToken 为用户签发 access token, 用于测试客户端直接传递 access token 的登录方式
+func (s *Server) AccessToken(clientID, subject string) (string, error) {
+	user, ok := s.findUser(subject)
+	if !ok {
+		return "", fmt.Errorf("user not found: %s", subject)
+	}
+	token := randomToken()
+	s.mu.Lock()
+	s.access[token] = &grant{user: user, clientID: clientID}
+	s.mu.Unlock()
+	return token, nil
+}
+
+// Active 判断 access token 或 refresh token 是否有效(未撤销)
+func (s *Server) Active(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.access[token]
+	if !ok {
+		_, ok = s.refresh[token]
+	}
+	return ok
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	ep := s.Endpoints("")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                ep.Issuer,
+		"authorization_endpoint":                ep.AuthURL,
+		"token_endpoint":                        ep.TokenURL,
+		"userinfo_endpoint":                     ep.UserURL,
+		"jwks_uri":                              ep.KeyURL,
+		"revocation_endpoint":                   ep.RevokeURL,
+		"response_types_supported":              []string{"code"},
+		"id_token_signing_alg_values_supported": []string{"RS256", "ES256"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	enc := base64.RawURLEncoding
+	ec := s.ecKey.PublicKey
+	size := (ec.Curve.Params().BitSize + 7) / 8
+	w.Header().Set("Cache-Control", "max-age=3600")
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{
+		{
+			"kty": "RSA",
+			"kid": KeyIDRSA,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   enc.EncodeToString(s.rsaKey.N.Bytes()),
+			"e":   enc.EncodeToString(big.NewInt(int64(s.rsaKey.E)).Bytes()),
+		},
+		{
+			"kty": "EC",
+			"kid": KeyIDEC,
+			"use": "sig",
+			"alg": "ES256",
+			"crv": ec.Curve.Params().Name,
+			"x":   enc.EncodeToString(ec.X.FillBytes(make([]byte, size))),
+			"y":   enc.EncodeToString(ec.Y.FillBytes(make([]byte, size))),
+		},
+	}})
+}
+
+// handleAuthorize 不展示授权页面, 直接以 login_hint 指定的用户(默认第一个)同意授权.
+// 抖音、微信、支付宝的 client id 参数分别为 client_key、appid、app_id, 支付宝不传 response_type
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	clientID := cmp.Or(q.Get("client_id"), q.Get("client_key"), q.Get("appid"), q.Get("app_id"))
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" || clientID == "" {
+		http.Error(w, "invalid client_id or redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	res := redirect.Query()
+	if state := q.Get("state"); state != "" {
+		res.Set("state", state)
+	}
+	user, ok := s.findUser(q.Get("login_hint"))
+	if rt := q.Get("response_type"); rt != "code" && (rt != "" || q.Get("app_id") == "") {
+		res.Set("error", "unsupported_response_type")
+	} else if !ok {
+		res.Set("error", "access_denied")
+	} else {
+		code := randomToken()
+		s.mu.Lock()
+		s.codes[code] = &grant{
+			user:      user,
+			clientID:  clientID,
+			redirect:  q.Get("redirect_uri"),
+			challenge: q.Get("code_challenge"),
+			method:    q.Get("code_challenge_method"),
+			nonce:     q.Get("nonce"),
+			scope:     q.Get("scope"),
+		}
+		s.mu.Unlock()
+		if q.Get("app_id") != "" {
+			res.Set("auth_code", code)
+		} else {
+			res.Set("code", code)
+		}
+	}
+	redirect.RawQuery = res.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	clientID, _, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+	}
+
+	var g *grant
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		var err error
+		if g, err = s.exchange(r.PostForm, clientID); err != nil {
+			tokenError(w, "invalid_grant", err.Error())
+			return
+		}
+	case "refresh_token":
+		s.mu.Lock()
+		g = s.refresh[r.PostForm.Get("refresh_token")]
+		delete(s.refresh, r.PostForm.Get("refresh_token"))
+		s.mu.Unlock()
+		if g == nil {
+			tokenError(w, "invalid_grant", "invalid refresh_token")
+			return
+		}
+	default:
+		tokenError(w, "unsupported_grant_type", r.PostForm.Get("grant_type"))
+		return
+	}
+	if g.clientID != clientID {
+		tokenError(w, "invalid_client", "client_id mismatch")
+		return
+	}
+
+	idToken, err := s.signIDToken(g)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accessToken, refreshToken := s.issue(g)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(TokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"id_token":      idToken,
+		"scope":         g.scope,
+		// 微博随 token 返回用户ID
+		"uid": g.user.Subject,
+	})
+}
+
+// exchange 校验并消耗授权码, 授权码只能使用一次
+func (s *Server) exchange(form url.Values, clientID string) (*grant, error) {
+	s.mu.Lock()
+	g := s.codes[form.Get("code")]
+	delete(s.codes, form.Get("code"))
+	s.mu.Unlock()
+	switch {
+	case g == nil:
+		return nil, errors.New("invalid code")
+	case g.clientID != clientID:
+		return nil, errors.New("client_id mismatch")
+	case form.Get("redirect_uri") != "" && form.Get("redirect_uri") != g.redirect:
+		return nil, errors.New("redirect_uri mismatch")
+	case !verifyChallenge(g, form.Get("code_verifier")):
+		return nil, errors.New("invalid code_verifier")
+	}
+	return g, nil
+}
+
+// issue 签发 access token 和 refresh token
+func (s *Server) issue(g *grant) (accessToken, refreshToken string) {
+	accessToken, refreshToken = randomToken(), randomToken()
+	s.mu.Lock()
+	s.access[accessToken] = g
+	s.refresh[refreshToken] = g
+	s.mu.Unlock()
+	return accessToken, refreshToken
+}
+
+// handleRevoke 兼容 token(RFC 7009) 和 access_token(LINE) 两种参数
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	if token == "" {
+		token = r.FormValue("access_token")
+	}
+	s.mu.Lock()
+	delete(s.access, token)
+	delete(s.refresh, token)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleUserinfo(w http.ResponseWriter, r *http.Request) {
+	if u, ok := s.bearerUser(w, r); ok {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"sub":                u.Subject,
+			"name":               u.Name,
+			"preferred_username": u.Username,
+			"email":              u.Email,
+			"email_verified":     u.EmailVerified,
+			"picture":            u.Picture,
+			"phone_number":       u.Phone,
+		})
+	}
+}
+
+func (s *Server) handleGithubUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.bearerUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(u.Subject, 10, 64)
+	if err != nil {
+		http.Error(w, "github user id must be numeric", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":         id,
+		"login":      u.Username,
+		"name":       u.Name,
+		"avatar_url": u.Picture,
+	})
+}
+
+func (s *Server) handleGithubEmails(w http.ResponseWriter, r *http.Request) {
+	if u, ok := s.bearerUser(w, r); ok {
+		writeJSON(w, http.StatusOK, []map[string]any{
+			{"email": u.Email, "primary": true, "verified": u.EmailVerified},
+		})
+	}
+}
+
+func (s *Server) handleDiscordUser(w http.ResponseWriter, r *http.Request) {
+	if u, ok := s.bearerUser(w, r); ok {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"id":       u.Subject,
+			"username": u.Username,
+			"email":    u.Email,
+		})
+	}
+}
+
+func (s *Server) handleMicrosoftUser(w http.ResponseWriter, r *http.Request) {
+	if u, ok := s.bearerUser(w, r); ok {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"id":                u.Subject,
+			"displayName":       u.Name,
+			"mail":              u.Email,
+			"userPrincipalName": u.Username,
+			"mobilePhone":       u.Phone,
+		})
+	}
+}
+
+func (s *Server) handleFacebookUser(w http.ResponseWriter, r *http.Request) {
+	if u, ok := s.bearerUser(w, r); ok {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"id":      u.Subject,
+			"name":    u.Name,
+			"email":   u.Email,
+			"picture": map[string]any{"data": map[string]any{"url": u.Picture}},
+		})
+	}
+}
+
+func (s *Server) handleTwitterUser(w http.ResponseWriter, r *http.Request) {
+	if u, ok := s.bearerUser(w, r); ok {
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+			"id":                u.Subject,
+			"name":              u.Name,
+			"username":          u.Username,
+			"profile_image_url": u.Picture,
+		}})
+	}
+}
+
+// handleLineVerify 校验本服务器签发的 ID token, 返回其中的声明
+func (s *Server) handleLineVerify(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(r.FormValue("id_token"), claims, func(t *jwt.Token) (any, error) {
+		if t.Header["kid"] == KeyIDEC {
+			return &s.ecKey.PublicKey, nil
+		}
+		return &s.rsaKey.PublicKey, nil
+	})
+	switch {
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": err.Error()})
+	case !claims.VerifyAudience(r.FormValue("client_id"), true):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": "Invalid IdToken Audience."})
+	case r.FormValue("nonce") != "" && claims["nonce"] != r.FormValue("nonce"):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": "Invalid IdToken Nonce."})
+	default:
+		writeJSON(w, http.StatusOK, claims)
+	}
+}
+
+func (s *Server) handleFacebookDebug(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	g := s.access[r.FormValue("input_token")]
+	s.mu.Unlock()
+	if g == nil {
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+			"is_valid": false,
+			"error":    map[string]string{"message": "invalid access token"},
+		}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+		"app_id":     g.clientID,
+		"is_valid":   true,
+		"user_id":    g.user.Subject,
+		"expires_at": time.Now().Add(TokenTTL).Unix(),
+	}})
+}
+
+// handleQQMe 以 Subject 作为 openid 和 unionid
+func (s *Server) handleQQMe(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	g := s.access[r.FormValue("access_token")]
+	s.mu.Unlock()
+	if g == nil {
+		writeJSON(w, http.StatusOK, map[string]any{"error": 100016, "error_description": "access token check failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"client_id": g.clientID,
+		"openid":    g.user.Subject,
+		"unionid":   g.user.Subject,
+	})
+}
+
+func (s *Server) handleQQUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.tokenUser(r.FormValue("access_token"))
+	if !ok || r.FormValue("openid") != u.Subject {
+		writeJSON(w, http.StatusOK, map[string]any{"ret": 100016, "msg": "access token check failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ret":            0,
+		"nickname":       u.Name,
+		"figureurl_qq_2": u.Picture,
+	})
+}
+
+func (s *Server) handleWeiboUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.tokenUser(r.FormValue("access_token"))
+	if !ok || r.FormValue("uid") != u.Subject {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error_code": 21332, "error": "invalid_access_token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"idstr":        u.Subject,
+		"screen_name":  u.Name,
+		"avatar_large": u.Picture,
+	})
+}
+
+func (s *Server) handleDouyinToken(w http.ResponseWriter, r *http.Request) {
+	g, err := s.exchange(formValues(r), r.FormValue("client_key"))
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"error_code": 10008, "description": err.Error()}})
+		return
+	}
+	accessToken, refreshToken := s.issue(g)
+	writeJSON(w, http.StatusOK, map[string]any{"message": "success", "data": map[string]any{
+		"error_code":    0,
+		"access_token":  accessToken,
+		"expires_in":    int(TokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"open_id":       g.user.Subject,
+	}})
+}
+
+func (s *Server) handleDouyinUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.tokenUser(r.FormValue("access_token"))
+	if !ok {
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"error_code": 2190008, "description": "access token expired"}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"message": "success", "data": map[string]any{
+		"error_code": 0,
+		"open_id":    u.Subject,
+		"union_id":   u.Subject,
+		"nickname":   u.Name,
+		"avatar":     u.Picture,
+	}})
+}
+
+func (s *Server) handleWechatToken(w http.ResponseWriter, r *http.Request) {
+	g, err := s.exchange(formValues(r), r.FormValue("appid"))
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]any{"errcode": 40029, "errmsg": err.Error()})
+		return
+	}
+	accessToken, refreshToken := s.issue(g)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token":  accessToken,
+		"expires_in":    int(TokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"openid":        g.user.Subject,
+		"scope":         "snsapi_login",
+	})
+}
+
+func (s *Server) handleWechatUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.tokenUser(r.FormValue("access_token"))
+	if !ok || r.FormValue("openid") != u.Subject {
+		writeJSON(w, http.StatusOK, map[string]any{"errcode": 40001, "errmsg": "invalid credential"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"openid":     u.Subject,
+		"unionid":    u.Subject,
+		"nickname":   u.Name,
+		"headimgurl": u.Picture,
+	})
+}
+
+// handleCasdoorToken Casdoor 的 access token 为 JWT, 由 PublicKey 校验
+func (s *Server) handleCasdoorToken(w http.ResponseWriter, r *http.Request) {
+	g, err := s.exchange(formValues(r), r.FormValue("client_id"))
+	if err != nil {
+		tokenError(w, "invalid_grant", err.Error())
+		return
+	}
+	now := time.Now()
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":    s.URL,
+		"sub":    g.user.Subject,
+		"aud":    g.clientID,
+		"iat":    now.Unix(),
+		"exp":    now.Add(TokenTTL).Unix(),
+		"name":   g.user.Username,
+		"avatar": g.user.Picture,
+		"email":  g.user.Email,
+		"phone":  g.user.Phone,
+	}).SignedString(s.rsaKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.access[accessToken] = g
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(TokenTTL.Seconds()),
+	})
+}
+
+// handleAlipay 支付宝网关, 按 method 分发, 响应使用 PublicKey 对应的私钥签名
+func (s *Server) handleAlipay(w http.ResponseWriter, r *http.Request) {
+	method := r.FormValue("method")
+	var v any
+	switch method {
+	case "alipay.system.oauth.token":
+		g, err := s.exchange(formValues(r), r.FormValue("app_id"))
+		if err != nil {
+			v = map[string]string{"code": "40002", "msg": "Invalid Arguments", "sub_code": "isv.code-invalid", "sub_msg": err.Error()}
+			break
+		}
+		accessToken, refreshToken := s.issue(g)
+		v = map[string]any{
+			"code":          "10000",
+			"msg":           "Success",
+			"user_id":       g.user.Subject,
+			"open_id":       g.user.Subject,
+			"access_token":  accessToken,
+			"expires_in":    int(TokenTTL.Seconds()),
+			"refresh_token": refreshToken,
+		}
+	case "alipay.user.info.share":
+		u, ok := s.tokenUser(r.FormValue("auth_token"))
+		if !ok {
+			v = map[string]string{"code": "20001", "msg": "Insufficient Token Permissions", "sub_code": "aop.invalid-auth-token", "sub_msg": "invalid auth token"}
+			break
+		}
+		v = map[string]string{
+			"code":      "10000",
+			"msg":       "Success",
+			"user_id":   u.Subject,
+			"nick_name": u.Name,
+			"avatar":    u.Picture,
+			"mobile":    u.Phone,
+		}
+	default:
+		http.Error(w, "unsupported method: "+method, http.StatusBadRequest)
+		return
+	}
+
+	biz, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(biz)
+	sign, err := rsa.SignPKCS1v15(rand.Reader, s.rsaKey, crypto.SHA256, sum[:])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		strings.ReplaceAll(method, ".", "_") + "_response": json.RawMessage(biz),
+		"sign": base64.StdEncoding.EncodeToString(sign),
+	})
+}
+
+func (s *Server) signIDToken(g *grant) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                s.URL,
+		"sub":                g.user.Subject,
+		"aud":                g.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(TokenTTL).Unix(),
+		"name":               g.user.Name,
+		"preferred_username": g.user.Username,
+		"email":              g.user.Email,
+		"email_verified":     g.user.EmailVerified,
+		"picture":            g.user.Picture,
+		"phone_number":       g.user.Phone,
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+
+	s.mu.Lock()
+	alg := s.alg
+	s.mu.Unlock()
+	if alg == jwt.SigningMethodES256.Alg() {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = KeyIDEC
+		return token.SignedString(s.ecKey)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyIDRSA
+	return token.SignedString(s.rsaKey)
+}
+
+// findUser subject 为空时返回第一个用户
+func (s *Server) findUser(subject string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if subject == "" || u.Subject == subject {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *Server) bearerUser(w http.ResponseWriter, r *http.Request) (User, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		http.Error(w, "invalid access token", http.StatusUnauthorized)
+		return User{}, false
+	}
+	u, ok := s.tokenUser(token)
+	if !ok {
+		http.Error(w, "invalid access token", http.StatusUnauthorized)
+	}
+	return u, ok
+}
+
+// tokenUser 国内平台通过参数传递 access token, 错误格式各不相同, 由调用方返回
+func (s *Server) tokenUser(token string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g := s.access[token]; g != nil {
+		return g.user, true
+	}
+	return User{}, false
+}
+
+// formValues 合并 query 和表单参数, 部分平台使用 GET 换取 token
+func formValues(r *http.Request) url.Values {
+	_ = r.ParseForm()
+	return r.Form
+}
+
+// verifyChallenge 授权时未使用 PKCE 则跳过校验
+func verifyChallenge(g *grant, verifier string) bool {
+	if g.challenge == "" {
+		return true
+	}
+	if g.method != "S256" {
+		return verifier == g.challenge
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == g.challenge
+}
+
+func randomToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func tokenError(w http.ResponseWriter, code, desc string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": desc})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
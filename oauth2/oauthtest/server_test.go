@@ -0,0 +1,187 @@
+package oauthtest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/dmzlingyin/utils/oauth2"
+	"testing"
+)
+
+const (
+	clientID = "client"
+	redirect = "https://example.com/callback"
+)
+
+var testUser = User{
+	Subject:  "10001",
+	Name:     "Test User",
+	Username: "test",
+	Email:    "test@example.com",
+	Picture:  "https://example.com/avatar.png",
+
+	EmailVerified: true,
+}
+
+func TestProviders(t *testing.T) {
+	srv := NewServer(testUser)
+	defer srv.Close()
+
+	appleKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(appleKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	appKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alipayKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(appKey)})
+
+	builders := map[oauth2.OauthType]func(opts ...oauth2.Option) (oauth2.Provider, error){
+		oauth2.TypeGoogle:    oauth2.NewGoogleWith,
+		oauth2.TypeGithub:    oauth2.NewGithubWith,
+		oauth2.TypeDiscord:   oauth2.NewDiscordWith,
+		oauth2.TypeMicrosoft: oauth2.NewMicrosoftWith,
+		oauth2.TypeFacebook:  oauth2.NewFacebookWith,
+		oauth2.TypeTwitter:   oauth2.NewTwitterWith,
+		oauth2.TypeLine:      oauth2.NewLineWith,
+		oauth2.TypeQQ:        oauth2.NewQQWith,
+		oauth2.TypeWeibo:     oauth2.NewWeiboWith,
+		oauth2.TypeDouyin:    oauth2.NewDouyinWith,
+		oauth2.TypeWechat:    oauth2.NewWechatWith,
+		oauth2.TypeApple: func(opts ...oauth2.Option) (oauth2.Provider, error) {
+			return oauth2.NewAppleWith(append(opts, oauth2.AppleKey("team", "key", p8))...)
+		},
+		oauth2.TypeCasdoor: func(opts ...oauth2.Option) (oauth2.Provider, error) {
+			return oauth2.NewCasdoorWith(append(opts, oauth2.CasdoorApp("", "org", "app", srv.PublicKey()))...)
+		},
+		oauth2.TypeAlipay: func(opts ...oauth2.Option) (oauth2.Provider, error) {
+			return oauth2.NewAlipayWith(append(opts, oauth2.ClientSecret(string(alipayKey)), oauth2.AlipayPublicKey(string(srv.PublicKey()), false))...)
+		},
+	}
+	for ot, build := range builders {
+		t.Run(string(ot), func(t *testing.T) {
+			p, err := build(
+				oauth2.ClientID(clientID),
+				oauth2.ClientSecret("secret"),
+				oauth2.RedirectURL(redirect),
+				oauth2.OverrideEndpoints(srv.Endpoints(ot)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			login(t, srv, oauth2.New(oauth2.WithProvider(ot, p)), ot)
+		})
+	}
+
+	t.Run("oidc", func(t *testing.T) {
+		const typeCorp oauth2.OauthType = "corp"
+		c := oauth2.New(oauth2.WithProvider(typeCorp, oauth2.NewOIDC(srv.URL, clientID, "secret", redirect)))
+		login(t, srv, c, typeCorp)
+	})
+}
+
+func login(t *testing.T, srv *Server, c *oauth2.Client, ot oauth2.OauthType) {
+	ctx := context.Background()
+	addr, err := c.AuthCodeURL(ctx, ot, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err := srv.Login(addr, testUser.Subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, user, err := c.Authorize(ctx, &oauth2.AuthArgs{Type: ot, Code: code, State: state})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != testUser.Subject || user.Username == "" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+	// 只有这些平台会确认邮箱
+	verified := ot == oauth2.TypeGoogle || ot == oauth2.TypeApple || ot == oauth2.TypeGithub || ot == "corp"
+	if user.EmailVerified != verified {
+		t.Fatalf("unexpected email verified: %+v", user)
+	}
+
+	// 授权码只能使用一次
+	if _, _, err = c.Authorize(ctx, &oauth2.AuthArgs{Type: ot, Code: code}); err == nil {
+		t.Fatal("expected error for reused code")
+	}
+
+	refreshed, err := c.Refresh(ctx, ot, token.RefreshToken)
+	if err == oauth2.ErrNotSupported {
+		return
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Revoke(ctx, ot, refreshed.AccessToken); err != nil && err != oauth2.ErrNotSupported {
+		t.Fatal(err)
+	}
+	if err == nil && srv.Active(refreshed.AccessToken) {
+		t.Fatal("token should be revoked")
+	}
+}
+
+func TestIDToken(t *testing.T) {
+	srv := NewServer(testUser)
+	defer srv.Close()
+	if err := srv.SetAlgorithm("ES256"); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := oauth2.NewGoogleWith(oauth2.ClientID(clientID), oauth2.OverrideEndpoints(srv.Endpoints(oauth2.TypeGoogle)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := srv.IDToken(clientID, testUser.Subject, "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, user, err := p.Authorize(context.Background(), &oauth2.AuthArgs{Token: idToken, Nonce: "n1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != testUser.Subject || user.Email != testUser.Email || !user.EmailVerified {
+		t.Fatalf("invalid user: %+v", user)
+	}
+	if _, _, err = p.Authorize(context.Background(), &oauth2.AuthArgs{Token: idToken, Nonce: "n2"}); err == nil {
+		t.Fatal("expected nonce mismatch")
+	}
+}
+
+func TestFacebookToken(t *testing.T) {
+	srv := NewServer(testUser)
+	defer srv.Close()
+
+	p, err := oauth2.NewFacebookWith(oauth2.ClientID(clientID), oauth2.OverrideEndpoints(srv.Endpoints(oauth2.TypeFacebook)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, err := srv.AccessToken(clientID, testUser.Subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, user, err := p.Authorize(context.Background(), &oauth2.AuthArgs{Token: accessToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != testUser.Subject {
+		t.Fatalf("invalid user: %+v", user)
+	}
+
+	// 其他应用签发的 token 不能用于登录
+	other, _ := srv.AccessToken("other", testUser.Subject)
+	if _, _, err = p.Authorize(context.Background(), &oauth2.AuthArgs{Token: other}); err == nil {
+		t.Fatal("expected app id mismatch")
+	}
+}
@@ -0,0 +1,247 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dmzlingyin/utils/oauth2/jwt"
+	"golang.org/x/oauth2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OIDCScopeOpenID  = "openid"
+	OIDCScopeProfile = "profile"
+	OIDCScopeEmail   = "email"
+
+	oidcDiscoveryPath    = "/.well-known/openid-configuration"
+	oidcDiscoveryTimeout = 10 * time.Second
+)
+
+// OIDCDiscovery openid-configuration 中用到的字段
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// NewOIDC 通用的 OpenID Connect 登录, 首次使用时通过 issuer 的 discovery 文档获取各个端点,
+// 可以通过 Client.Register 注册为自定义的登录类型
+func NewOIDC(issuer, clientID, secret, redirect string) Provider {
+	o := &oidc{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		cfg: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: secret,
+			RedirectURL:  redirect,
+			Scopes:       []string{OIDCScopeOpenID, OIDCScopeProfile, OIDCScopeEmail},
+		},
+	}
+	return o
+}
+
+type oidc struct {
+	issuer string
+	cfg    *oauth2.Config
+
+	mu sync.Mutex
+	ep *oidcEndpoint // discovery 成功后缓存
+}
+
+type oidcEndpoint struct {
+	cfg         *oauth2.Config
+	userinfoURL string
+	decoder     *jwt.Decoder
+}
+
+// endpoint 首次使用时获取 discovery 文档, 失败时下次调用重试
+func (o *oidc) endpoint(ctx context.Context) (*oidcEndpoint, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.ep != nil {
+		return o.ep, nil
+	}
+	ep, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.ep = ep
+	return ep, nil
+}
+
+func (o *oidc) discover(ctx context.Context) (*oidcEndpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, oidcDiscoveryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.issuer+oidcDiscoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := httpClient(ctx)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery error, status: %d", resp.StatusCode)
+	}
+
+	var d OIDCDiscovery
+	if err = json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, err
+	}
+	// 规范要求 discovery 中的 issuer 与配置的完全一致
+	if strings.TrimSuffix(d.Issuer, "/") != o.issuer {
+		return nil, fmt.Errorf("oidc issuer mismatch: %s", d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JwksURI == "" {
+		return nil, errors.New("oidc discovery document is incomplete")
+	}
+
+	cfg := *o.cfg
+	cfg.Endpoint = oauth2.Endpoint{
+		AuthURL:  d.AuthorizationEndpoint,
+		TokenURL: d.TokenEndpoint,
+	}
+	return &oidcEndpoint{
+		cfg:         &cfg,
+		userinfoURL: d.UserinfoEndpoint,
+		decoder:     jwt.NewDecoder(d.JwksURI, jwt.Issuers(d.Issuer), jwt.Audiences(o.cfg.ClientID), jwt.HTTPClient(client)),
+	}, nil
+}
+
+// AuthCodeURL discovery 失败时返回空字符串
+func (o *oidc) AuthCodeURL(state, verifier, redirect string) string {
+	ep, err := o.endpoint(context.Background())
+	if err != nil {
+		return ""
+	}
+	var opts []oauth2.AuthCodeOption
+	if verifier != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", oidcNonce(verifier)))
+	}
+	return authCodeURL(ep.cfg, state, verifier, redirect, true, opts...)
+}
+
+func (o *oidc) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
+	ep, err := o.endpoint(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	token, err = ep.cfg.Exchange(ctx, args.Code, exchangeOptions(args, true)...)
+	if err != nil {
+		return nil, nil, err
+	} else if !token.Valid() {
+		return nil, nil, errors.New("invalid token")
+	}
+
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, nil, errors.New("id_token not found")
+	}
+	var nonce string
+	if args.Verifier != "" {
+		nonce = oidcNonce(args.Verifier)
+	}
+	claims, err := ep.decoder.DecodeWithNonce(idToken, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	user = &User{
+		ID:            claims.Subject,
+		Username:      claims.PreferredUsername,
+		Avatar:        claims.Picture,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Phone:         claims.PhoneNumber,
+	}
+	if user.Username == "" {
+		user.Username = claims.Name
+	}
+
+	// id_token 中不一定包含 profile, 从 userinfo 补全
+	if ep.userinfoURL != "" && (user.Username == "" || user.Email == "") {
+		if err = o.fillUserinfo(ctx, ep, token, user); err != nil {
+			return nil, nil, err
+		}
+	}
+	return token, user, nil
+}
+
+func (o *oidc) fillUserinfo(ctx context.Context, ep *oidcEndpoint, token *oauth2.Token, user *User) error {
+	res, err := ep.cfg.Client(ctx, token).Get(ep.userinfoURL)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc userinfo error, status: %d", res.StatusCode)
+	}
+
+	var u struct {
+		Sub               string `json:"sub"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+		Picture           string `json:"picture"`
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PhoneNumber       string `json:"phone_number"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&u); err != nil {
+		return err
+	}
+	// userinfo 的 sub 必须与 id_token 一致
+	if u.Sub != user.ID {
+		return errors.New("oidc userinfo subject mismatch")
+	}
+	if user.Username == "" {
+		user.Username = u.PreferredUsername
+	}
+	if user.Username == "" {
+		user.Username = u.Name
+	}
+	if user.Avatar == "" {
+		user.Avatar = u.Picture
+	}
+	if user.Email == "" {
+		user.Email = u.Email
+		user.EmailVerified = u.EmailVerified
+	}
+	if user.Phone == "" {
+		user.Phone = u.PhoneNumber
+	}
+	return nil
+}
+
+// verifyIDToken 校验客户端直接传递的 ID token
+func verifyIDToken(decoder *jwt.Decoder, idToken, nonce string) (*oauth2.Token, *User, error) {
+	claims, err := decoder.DecodeWithNonce(idToken, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	token := &oauth2.Token{
+		TokenType: "Bearer",
+		Expiry:    time.Unix(claims.ExpiresAt, 0),
+	}
+	return token.WithExtra(map[string]any{"id_token": idToken}), &User{
+		ID:            claims.Subject,
+		Username:      claims.Name,
+		Avatar:        claims.Picture,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+	}, nil
+}
+
+// oidcNonce 由 PKCE 校验码派生 nonce, 无需额外保存
+func oidcNonce(verifier string) string {
+	sum := sha256.Sum256([]byte("nonce:" + verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,162 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	mjwt "github.com/dmzlingyin/utils/oauth2/jwt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestOIDC(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nonce string
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(OIDCDiscovery{
+			Issuer:                srv.URL,
+			AuthorizationEndpoint: srv.URL + "/authorize",
+			TokenEndpoint:         srv.URL + "/token",
+			UserinfoEndpoint:      srv.URL + "/userinfo",
+			JwksURI:               srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   enc.EncodeToString(key.N.Bytes()),
+			"e":   enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code_verifier") == "" {
+			http.Error(w, "missing code_verifier", http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   srv.URL,
+			"sub":   "u1",
+			"aud":   "client",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": nonce,
+			"email": "u1@example.com",
+		})
+		token.Header["kid"] = "k1"
+		idToken, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"sub": "u1", "preferred_username": "user1"})
+	})
+
+	ctx := context.Background()
+	const typeCorp OauthType = "corp"
+	c := New()
+	c.Register(typeCorp, NewOIDC(srv.URL, "client", "secret", "https://example.com/callback"))
+	addr, err := c.AuthCodeURL(ctx, typeCorp, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce = u.Query().Get("nonce")
+	if nonce == "" {
+		t.Fatal("nonce not found: " + addr)
+	}
+
+	_, user, err := c.Authorize(ctx, &AuthArgs{Type: typeCorp, Code: "code", State: u.Query().Get("state")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "u1" || user.Email != "u1@example.com" || user.Username != "user1" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+}
+
+func TestIDTokenLogin(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   enc.EncodeToString(key.N.Bytes()),
+			"e":   enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer srv.Close()
+
+	sign := func(aud string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   GoogleIssuer,
+			"sub":   "u1",
+			"aud":   aud,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "n",
+			"email": "u1@example.com",
+		})
+		token.Header["kid"] = "k1"
+		s, _ := token.SignedString(key)
+		return s
+	}
+
+	g := &google{decoder: mjwt.NewDecoder(srv.URL, mjwt.Issuers(GoogleIssuer), mjwt.Audiences("web", "ios"))}
+	token, user, err := g.Authorize(context.Background(), &AuthArgs{Type: TypeGoogle, Token: sign("ios"), Nonce: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "u1" || user.Email != "u1@example.com" || token.Extra("id_token") == nil {
+		t.Fatalf("invalid user: %+v", user)
+	}
+	if _, _, err = g.Authorize(context.Background(), &AuthArgs{Type: TypeGoogle, Token: sign("other")}); err == nil {
+		t.Fatal("token of other audience should be rejected")
+	}
+}
+
+// issuer 无响应时 Authorize 随 ctx 结束返回
+func TestOIDCDiscoveryTimeout(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	p := NewOIDC(srv.URL, "client", "secret", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := p.Authorize(ctx, &AuthArgs{Code: "code"}); err == nil {
+		t.Fatal("discovery should fail")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("discovery should respect ctx")
+	}
+}
@@ -0,0 +1,205 @@
+package oauth2
+
+import (
+	"cmp"
+	"github.com/dmzlingyin/utils/config"
+	"golang.org/x/oauth2"
+	"os"
+)
+
+// Option 登录方式的显式配置, 用于 NewXxxWith 系列构造函数
+type Option interface {
+	apply(*providerOptions)
+}
+
+type optionFunc func(*providerOptions)
+
+func (f optionFunc) apply(o *providerOptions) {
+	f(o)
+}
+
+type providerOptions struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	audiences    []string
+	endpoints    Endpoints
+
+	// Apple
+	teamID     string
+	keyID      string
+	privateKey []byte
+
+	// Casdoor
+	endpoint     string
+	organization string
+	application  string
+	certificate  []byte
+
+	// Microsoft
+	tenant string
+
+	// Alipay
+	alipayPublicKey string
+	production      bool
+}
+
+func newOptions(opts []Option, scopes ...string) *providerOptions {
+	o := &providerOptions{scopes: scopes}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	return o
+}
+
+// ClientID 设置应用ID, 微信为 appid, 抖音为 client_key, 支付宝为 app_id
+func ClientID(id string) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.clientID = id
+	})
+}
+
+// ClientSecret 设置应用密钥, 支付宝为应用私钥
+func ClientSecret(secret string) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.clientSecret = secret
+	})
+}
+
+// RedirectURL 设置默认的回调地址
+func RedirectURL(url string) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.redirectURL = url
+	})
+}
+
+// Scopes 覆盖默认的授权范围
+func Scopes(scopes ...string) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.scopes = scopes
+	})
+}
+
+// Audiences 设置额外允许的 ID token 受众, 例如移动端的 client id
+func Audiences(audiences ...string) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.audiences = audiences
+	})
+}
+
+// Endpoints 第三方平台的接口地址, 用于对接测试服务器(oauthtest)或代理
+type Endpoints struct {
+	AuthURL      string // 授权页面
+	TokenURL     string // code 换取 token
+	UserURL      string // 用户信息, LINE 为 ID token 校验接口
+	KeyURL       string // ID token 签名公钥(JWKS)
+	RevokeURL    string // 撤销 token
+	Issuer       string // ID token 签发者
+	TokenInfoURL string // access token 信息, QQ 用于获取 openid, Facebook 用于校验客户端传递的 token
+	APIURL       string // 接口根地址, 微信和 Casdoor 的接口均在该地址下, 支付宝为网关地址
+}
+
+// OverrideEndpoints 覆盖默认的接口地址, 为空的字段保持默认值
+func OverrideEndpoints(e Endpoints) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.endpoints = e
+	})
+}
+
+// AppleKey 设置苹果登录用于生成 client secret 的密钥(.p8 文件内容)
+func AppleKey(teamID, keyID string, key []byte) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.teamID = teamID
+		o.keyID = keyID
+		o.privateKey = key
+	})
+}
+
+// CasdoorApp 设置 Casdoor 的服务地址、组织、应用及证书
+func CasdoorApp(endpoint, organization, application string, certificate []byte) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.endpoint = endpoint
+		o.organization = organization
+		o.application = application
+		o.certificate = certificate
+	})
+}
+
+// Tenant 设置微软登录的租户, 默认为 common
+func Tenant(tenant string) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.tenant = tenant
+	})
+}
+
+// AlipayPublicKey 设置支付宝公钥及是否为生产环境
+func AlipayPublicKey(publicKey string, production bool) Option {
+	return optionFunc(func(o *providerOptions) {
+		o.alipayPublicKey = publicKey
+		o.production = production
+	})
+}
+
+// configOptions 从全局配置 <prefix>.client_id 等读取通用配置
+func configOptions(prefix string) []Option {
+	opts := []Option{
+		ClientID(config.GetString(prefix + ".client_id")),
+		ClientSecret(config.GetString(prefix + ".client_secret")),
+		RedirectURL(config.GetString(prefix + ".redirect_url")),
+	}
+	if audiences := configStrings(prefix + ".client_ids"); len(audiences) > 0 {
+		opts = append(opts, Audiences(audiences...))
+	}
+	return opts
+}
+
+// configFile 读取配置中指定路径的文件, 未配置时返回 nil, 由构造函数返回缺少密钥的错误
+func configFile(field string) []byte {
+	path := config.GetString(field)
+	if path == "" {
+		return nil
+	}
+	file, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	return file
+}
+
+// must 内置的 Builder 读取全局配置, 配置错误时 panic
+func must(p Provider, err error) Provider {
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// resolveEndpoints 使用覆盖的地址替换默认值
+func (o *providerOptions) resolveEndpoints(def Endpoints) Endpoints {
+	e := o.endpoints
+	return Endpoints{
+		AuthURL:      cmp.Or(e.AuthURL, def.AuthURL),
+		TokenURL:     cmp.Or(e.TokenURL, def.TokenURL),
+		UserURL:      cmp.Or(e.UserURL, def.UserURL),
+		KeyURL:       cmp.Or(e.KeyURL, def.KeyURL),
+		RevokeURL:    cmp.Or(e.RevokeURL, def.RevokeURL),
+		Issuer:       cmp.Or(e.Issuer, def.Issuer),
+		TokenInfoURL: cmp.Or(e.TokenInfoURL, def.TokenInfoURL),
+		APIURL:       cmp.Or(e.APIURL, def.APIURL),
+	}
+}
+
+func (o *providerOptions) oauth2Config(authURL, tokenURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     o.clientID,
+		ClientSecret: o.clientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   authURL,
+			TokenURL:  tokenURL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		RedirectURL: o.redirectURL,
+		Scopes:      o.scopes,
+	}
+}
@@ -0,0 +1,392 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/smartwalle/alipay/v3"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rewriteTransport 把请求转发到测试服务器, 保留原始的 Host 便于按域名路由
+type rewriteTransport struct {
+	base   http.RoundTripper
+	target *url.URL
+}
+
+func (rt rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Host = req.URL.Host
+	r.URL.Scheme = rt.target.Scheme
+	r.URL.Host = rt.target.Host
+	return rt.base.RoundTrip(r)
+}
+
+// newProviderServer 启动测试服务器并接管默认的 http.Transport, 各平台的固定地址都会请求到 mux
+func newProviderServer(t *testing.T, mux *http.ServeMux) {
+	srv := httptest.NewServer(mux)
+	target, _ := url.Parse(srv.URL)
+	base := http.DefaultTransport
+	http.DefaultTransport = rewriteTransport{base: base, target: target}
+	t.Cleanup(func() {
+		http.DefaultTransport = base
+		srv.Close()
+	})
+}
+
+func writeTestJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestQQ(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("graph.qq.com/oauth2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "c" || r.FormValue("fmt") != "json" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeTestJSON(w, map[string]any{"error": 100019, "error_description": "code to access token error"})
+			return
+		}
+		writeTestJSON(w, map[string]any{"access_token": "at", "expires_in": 7200, "refresh_token": "rt"})
+	})
+	mux.HandleFunc("graph.qq.com/oauth2.0/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("unionid") != "1" {
+			writeTestJSON(w, map[string]any{"error": 100016, "error_description": "access token check failed"})
+			return
+		}
+		writeTestJSON(w, map[string]any{"client_id": "a", "openid": "o1", "unionid": "u1"})
+	})
+	var userRet int
+	mux.HandleFunc("graph.qq.com/user/get_user_info", func(w http.ResponseWriter, r *http.Request) {
+		if userRet != 0 || r.FormValue("openid") != "o1" {
+			writeTestJSON(w, map[string]any{"ret": 1002, "msg": "user not found"})
+			return
+		}
+		writeTestJSON(w, map[string]any{"ret": 0, "nickname": "nick", "figureurl_qq_1": "https://img/40", "figureurl_qq_2": ""})
+	})
+	newProviderServer(t, mux)
+
+	ctx := context.Background()
+	p := NewQQ()
+	token, user, err := p.Authorize(ctx, &AuthArgs{Type: TypeQQ, Code: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 100x100 的头像时使用 40x40 的头像
+	if token.AccessToken != "at" || user.ID != "o1" || user.UnionID != "u1" || user.Username != "nick" || user.Avatar != "https://img/40" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+
+	if _, _, err = p.Authorize(ctx, &AuthArgs{Type: TypeQQ, Code: "bad"}); err == nil {
+		t.Fatal("invalid code should fail")
+	}
+	userRet = 1002
+	if _, _, err = p.Authorize(ctx, &AuthArgs{Type: TypeQQ, Code: "c"}); err == nil || err.Error() != "user not found" {
+		t.Fatalf("user info error should be returned, got %v", err)
+	}
+}
+
+func TestWeibo(t *testing.T) {
+	var uid string
+	mux := http.NewServeMux()
+	mux.HandleFunc("api.weibo.com/oauth2/access_token", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]any{"access_token": "at", "expires_in": 7200, "uid": uid})
+	})
+	mux.HandleFunc("api.weibo.com/2/users/show.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("uid") != "1001" {
+			writeTestJSON(w, map[string]any{"error_code": 20003, "error": "User does not exists!"})
+			return
+		}
+		writeTestJSON(w, map[string]any{"idstr": "1001", "screen_name": "nick", "avatar_large": "", "profile_image_url": "https://img/50"})
+	})
+	newProviderServer(t, mux)
+
+	ctx := context.Background()
+	p := NewWeibo()
+	// uid 不在 token 中时无法获取用户信息
+	if _, _, err := p.Authorize(ctx, &AuthArgs{Type: TypeWeibo, Code: "c"}); err == nil {
+		t.Fatal("missing uid should fail")
+	}
+
+	uid = "1001"
+	token, user, err := p.Authorize(ctx, &AuthArgs{Type: TypeWeibo, Code: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" || user.ID != "1001" || user.Username != "nick" || user.Avatar != "https://img/50" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+
+	uid = "1002"
+	if _, _, err = p.Authorize(ctx, &AuthArgs{Type: TypeWeibo, Code: "c"}); err == nil || !strings.Contains(err.Error(), "20003") {
+		t.Fatalf("user info error should be returned, got %v", err)
+	}
+}
+
+func TestDouyin(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("open.douyin.com/oauth/access_token/", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "c" || r.PostFormValue("grant_type") != "authorization_code" {
+			writeTestJSON(w, map[string]any{"data": map[string]any{"error_code": 10007, "description": "code expired"}, "message": "error"})
+			return
+		}
+		writeTestJSON(w, map[string]any{"data": map[string]any{
+			"error_code": 0, "access_token": "at", "expires_in": 86400, "refresh_token": "rt", "open_id": "o1",
+		}, "message": "success"})
+	})
+	mux.HandleFunc("open.douyin.com/oauth/userinfo/", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("access_token") != "at" || r.PostFormValue("open_id") != "o1" {
+			writeTestJSON(w, map[string]any{"data": map[string]any{"error_code": 2190008, "description": "access_token expired"}, "message": "error"})
+			return
+		}
+		writeTestJSON(w, map[string]any{"data": map[string]any{
+			"error_code": 0, "open_id": "o1", "union_id": "u1", "nickname": "nick", "avatar": "https://img",
+		}, "message": "success"})
+	})
+	newProviderServer(t, mux)
+
+	ctx := context.Background()
+	p := NewDouyin()
+	token, user, err := p.Authorize(ctx, &AuthArgs{Type: TypeDouyin, Code: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" || token.RefreshToken != "rt" || !token.Valid() {
+		t.Fatalf("invalid token: %+v", token)
+	}
+	if user.ID != "o1" || user.UnionID != "u1" || user.Username != "nick" || user.Avatar != "https://img" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+
+	if _, _, err = p.Authorize(ctx, &AuthArgs{Type: TypeDouyin, Code: "bad"}); err == nil || !strings.Contains(err.Error(), "10007") {
+		t.Fatalf("token error should be returned, got %v", err)
+	}
+}
+
+func TestAlipay(t *testing.T) {
+	// 支付宝的响应需要签名, 测试中生成一对密钥代替支付宝公钥
+	alipayKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&alipayKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var infoFailed bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("openapi.alipay.com/gateway.do", func(w http.ResponseWriter, r *http.Request) {
+		method := r.FormValue("method")
+		var v any
+		switch {
+		case method == "alipay.system.oauth.token" && r.FormValue("code") == "c":
+			v = map[string]any{
+				"code": "10000", "msg": "Success", "user_id": "2088", "open_id": "o1", "union_id": "u1",
+				"access_token": "at", "expires_in": 7200, "refresh_token": "rt",
+			}
+		case method == "alipay.system.oauth.token":
+			v = map[string]any{"code": "40002", "msg": "Invalid Arguments", "sub_code": "isv.code-invalid", "sub_msg": "invalid code"}
+		case method == "alipay.user.info.share" && !infoFailed:
+			v = map[string]any{"code": "10000", "msg": "Success", "nick_name": "nick", "avatar": "https://img", "mobile": "13800000000"}
+		default:
+			v = map[string]any{"code": "20001", "msg": "Insufficient Token Permissions", "sub_code": "aop.invalid-auth-token", "sub_msg": "invalid auth token"}
+		}
+		biz, _ := json.Marshal(v)
+		sum := sha256.Sum256(biz)
+		sign, err := rsa.SignPKCS1v15(rand.Reader, alipayKey, crypto.SHA256, sum[:])
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeTestJSON(w, map[string]any{
+			strings.ReplaceAll(method, ".", "_") + "_response": json.RawMessage(biz),
+			"sign": base64.StdEncoding.EncodeToString(sign),
+		})
+	})
+	newProviderServer(t, mux)
+
+	client, err := alipay.New("app", string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(appKey)})), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.LoadAliPayPublicKey(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	p := &alipayAuth{client: client}
+	token, user, err := p.Authorize(ctx, &AuthArgs{Type: TypeAlipay, Code: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 优先使用 open_id
+	if token.AccessToken != "at" || user.ID != "o1" || user.UnionID != "u1" || user.Username != "nick" || user.Phone != "13800000000" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+
+	if _, _, err = p.Authorize(ctx, &AuthArgs{Type: TypeAlipay, Code: "bad"}); err == nil {
+		t.Fatal("invalid code should fail")
+	}
+	infoFailed = true
+	if _, _, err = p.Authorize(ctx, &AuthArgs{Type: TypeAlipay, Code: "c"}); err == nil {
+		t.Fatal("user info error should be returned")
+	}
+}
+
+func TestGithub(t *testing.T) {
+	var emails []map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("github.com/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "c" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeTestJSON(w, map[string]any{"error": "bad_verification_code"})
+			return
+		}
+		writeTestJSON(w, map[string]any{"access_token": "at", "token_type": "bearer", "scope": "read:user,user:email"})
+	})
+	mux.HandleFunc("api.github.com/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeTestJSON(w, map[string]any{"id": 1001, "login": "octocat", "name": "", "email": "public@example.com", "avatar_url": "https://img"})
+	})
+	mux.HandleFunc("api.github.com/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, emails)
+	})
+	newProviderServer(t, mux)
+
+	ctx := context.Background()
+	p := NewGithub()
+	// 公开邮箱不可信, 没有已验证的主邮箱时 Email 为空
+	emails = []map[string]any{
+		{"email": "primary@example.com", "primary": true, "verified": false},
+		{"email": "other@example.com", "primary": false, "verified": true},
+	}
+	token, user, err := p.Authorize(ctx, &AuthArgs{Type: TypeGithub, Code: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" || user.ID != "1001" || user.Username != "octocat" || user.Avatar != "https://img" || user.Email != "" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+
+	emails[0]["verified"] = true
+	if _, user, err = p.Authorize(ctx, &AuthArgs{Type: TypeGithub, Code: "c"}); err != nil || user.Email != "primary@example.com" {
+		t.Fatalf("primary email should be used: %+v, %v", user, err)
+	}
+
+	if _, _, err = p.Authorize(ctx, &AuthArgs{Type: TypeGithub, Code: "bad"}); err == nil {
+		t.Fatal("invalid code should fail")
+	}
+}
+
+func TestMicrosoft(t *testing.T) {
+	var status int
+	mux := http.NewServeMux()
+	mux.HandleFunc("login.microsoftonline.com/common/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]any{"access_token": "at", "token_type": "Bearer", "expires_in": 3600})
+	})
+	mux.HandleFunc("graph.microsoft.com/v1.0/me", func(w http.ResponseWriter, r *http.Request) {
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		writeTestJSON(w, map[string]any{
+			"id": "m1", "displayName": "Test User", "mail": nil,
+			"userPrincipalName": "test_outlook.com#EXT#@tenant.onmicrosoft.com", "mobilePhone": "13800000000",
+		})
+	})
+	newProviderServer(t, mux)
+
+	ctx := context.Background()
+	p := NewMicrosoft()
+	token, user, err := p.Authorize(ctx, &AuthArgs{Type: TypeMicrosoft, Code: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// UPN 不一定能收信, 不能作为邮箱
+	if token.AccessToken != "at" || user.ID != "m1" || user.Username != "Test User" || user.Email != "" || user.Phone != "13800000000" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+
+	status = http.StatusUnauthorized
+	if _, _, err = p.Authorize(ctx, &AuthArgs{Type: TypeMicrosoft, Code: "c"}); err == nil {
+		t.Fatal("graph error should be returned")
+	}
+}
+
+func TestLine(t *testing.T) {
+	var idToken string
+	mux := http.NewServeMux()
+	mux.HandleFunc("api.line.me/oauth2/v2.1/token", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]any{"access_token": "at", "token_type": "Bearer", "expires_in": 2592000, "id_token": idToken})
+	})
+	mux.HandleFunc("api.line.me/oauth2/v2.1/verify", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("id_token") != "valid" || r.PostFormValue("nonce") != oidcNonce("v") {
+			w.WriteHeader(http.StatusBadRequest)
+			writeTestJSON(w, map[string]any{"error": "invalid_request", "error_description": "Invalid IdToken."})
+			return
+		}
+		writeTestJSON(w, map[string]any{"sub": "U1", "name": "nick", "picture": "https://img", "email": "a@example.com"})
+	})
+	newProviderServer(t, mux)
+
+	ctx := context.Background()
+	p := NewLine()
+	if _, _, err := p.Authorize(ctx, &AuthArgs{Type: TypeLine, Code: "c", Verifier: "v"}); err == nil {
+		t.Fatal("missing id_token should fail")
+	}
+
+	idToken = "valid"
+	token, user, err := p.Authorize(ctx, &AuthArgs{Type: TypeLine, Code: "c", Verifier: "v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" || user.ID != "U1" || user.Username != "nick" || user.Avatar != "https://img" || user.Email != "a@example.com" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+
+	// 客户端 SDK 获取的 ID token
+	if _, user, err = p.Authorize(ctx, &AuthArgs{Type: TypeLine, Token: "valid", Nonce: oidcNonce("v")}); err != nil || user.ID != "U1" {
+		t.Fatalf("id token login failed: %+v, %v", user, err)
+	}
+	if _, _, err = p.Authorize(ctx, &AuthArgs{Type: TypeLine, Token: "forged", Nonce: oidcNonce("v")}); err == nil || err.Error() != "Invalid IdToken." {
+		t.Fatalf("verify error should be returned, got %v", err)
+	}
+}
+
+func TestGithubContext(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("github.com/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]any{"access_token": "at", "token_type": "bearer"})
+	})
+	mux.HandleFunc("api.github.com/user", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	newProviderServer(t, mux)
+
+	// 获取用户信息的请求随 ctx 取消
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := NewGithub().Authorize(ctx, &AuthArgs{Type: TypeGithub, Code: "c"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request should be canceled with ctx, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/oauth2"
+	"net/url"
+)
+
+const (
+	QQAuthURL  = "https://graph.qq.com/oauth2.0/authorize"
+	QQTokenURL = "https://graph.qq.com/oauth2.0/token"
+	QQMeURL    = "https://graph.qq.com/oauth2.0/me"
+	QQUserURL  = "https://graph.qq.com/user/get_user_info"
+)
+
+const QQScopeUserInfo = "get_user_info"
+
+func NewQQ() Provider {
+	return must(NewQQWith(configOptions("oauth2.qq")...))
+}
+
+func NewQQWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts, QQScopeUserInfo)
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL:      QQAuthURL,
+		TokenURL:     QQTokenURL,
+		UserURL:      QQUserURL,
+		TokenInfoURL: QQMeURL,
+	})
+	return &qq{
+		cfg: o.oauth2Config(ep.AuthURL, ep.TokenURL),
+		ep:  ep,
+	}, nil
+}
+
+type qq struct {
+	cfg *oauth2.Config
+	ep  Endpoints
+}
+
+func (q *qq) AuthCodeURL(state, verifier, redirect string) string {
+	return authCodeURL(q.cfg, state, verifier, redirect, false)
+}
+
+func (q *qq) Authorize(ctx context.Context, args *AuthArgs) (*oauth2.Token, *User, error) {
+	// 默认返回的是 urlencoded 格式, 需要指定 fmt=json
+	opts := append(exchangeOptions(args, false), oauth2.SetAuthURLParam("fmt", "json"))
+	token, err := q.cfg.Exchange(ctx, args.Code, opts...)
+	if err != nil {
+		return nil, nil, err
+	} else if !token.Valid() {
+		return nil, nil, errors.New("invalid token")
+	}
+
+	// 通过 access token 获取 openid 和 unionid
+	v := url.Values{}
+	v.Set("access_token", token.AccessToken)
+	v.Set("unionid", "1")
+	v.Set("fmt", "json")
+	var me struct {
+		ClientID         string `json:"client_id"`
+		OpenID           string `json:"openid"`
+		UnionID          string `json:"unionid"`
+		Error            int    `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = getJSON(ctx, q.ep.TokenInfoURL+"?"+v.Encode(), &me); err != nil {
+		return nil, nil, err
+	}
+	if me.Error != 0 {
+		return nil, nil, errors.New(me.ErrorDescription)
+	}
+
+	v = url.Values{}
+	v.Set("access_token", token.AccessToken)
+	v.Set("oauth_consumer_key", q.cfg.ClientID)
+	v.Set("openid", me.OpenID)
+	var u struct {
+		Ret          int    `json:"ret"`
+		Msg          string `json:"msg"`
+		Nickname     string `json:"nickname"`
+		FigureURLQQ1 string `json:"figureurl_qq_1"`
+		FigureURLQQ2 string `json:"figureurl_qq_2"`
+	}
+	if err = getJSON(ctx, q.ep.UserURL+"?"+v.Encode(), &u); err != nil {
+		return nil, nil, err
+	}
+	if u.Ret != 0 {
+		return nil, nil, errors.New(u.Msg)
+	}
+
+	// 100x100 的头像不一定存在
+	avatar := u.FigureURLQQ2
+	if avatar == "" {
+		avatar = u.FigureURLQQ1
+	}
+	return token, &User{
+		ID:       me.OpenID,
+		Username: u.Nickname,
+		Avatar:   avatar,
+		UnionID:  me.UnionID,
+	}, nil
+}
@@ -0,0 +1,153 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/dmzlingyin/utils/cache"
+	"golang.org/x/oauth2"
+	"time"
+)
+
+const (
+	DefaultStateTTL = 10 * time.Minute
+	stateKeyPrefix  = "oauth2:state:"
+	stateUsedSuffix = ":used"
+)
+
+var (
+	ErrInvalidState  = errors.New("invalid or expired oauth2 state")
+	ErrStateRequired = errors.New("oauth2 state is required")
+)
+
+// authState 发起授权时保存的上下文, 回调时据此校验
+type authState struct {
+	Type     OauthType `json:"type"`
+	Verifier string    `json:"verifier"`
+	Redirect string    `json:"redirect"`
+}
+
+// SetStateCache 设置保存 state 的缓存, 多实例部署时应使用 Redis 等共享缓存
+func (c *Client) SetStateCache(ch cache.Cache, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultStateTTL
+	}
+	c.states = ch
+	c.stateTTL = ttl
+}
+
+// AllowStateless 允许这些登录方式在没有 state 时登录, 以及使用调用方自行生成并校验的 state,
+// 用于客户端通过原生 SDK 获取 code 的场景. 此时 Client 不再校验 CSRF, 也无法提供 PKCE 校验码和 OIDC nonce.
+// 微信小程序登录没有 state, 默认允许
+func (c *Client) AllowStateless(ots ...OauthType) {
+	for _, ot := range ots {
+		c.stateless[ot] = true
+	}
+}
+
+// AuthCodeURL 生成授权跳转链接, 随机的 state 和 PKCE 校验码会保存到缓存中, 在 Authorize 时校验
+func (c *Client) AuthCodeURL(ctx context.Context, ot OauthType, redirect string) (string, error) {
+	p, ok := c.providers[ot]
+	if !ok {
+		return "", fmt.Errorf("not supported oauth type: %s", ot)
+	}
+	b, ok := p.(URLBuilder)
+	if !ok {
+		return "", fmt.Errorf("oauth type %s doesn't support auth code url", ot)
+	}
+
+	state, err := randomState()
+	if err != nil {
+		return "", err
+	}
+	as := authState{
+		Type:     ot,
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: redirect,
+	}
+	u := b.AuthCodeURL(state, as.Verifier, redirect)
+	if u == "" {
+		return "", fmt.Errorf("build auth code url of %s failed", ot)
+	}
+	if err = c.states.SetWithTTL(ctx, stateKeyPrefix+state, as, c.stateTTL); err != nil {
+		return "", err
+	}
+	return u, nil
+}
+
+// checkState 授权码登录需要校验 state, 调用 AllowStateless 的登录方式除外
+func (c *Client) checkState(ctx context.Context, p Provider, args *AuthArgs) error {
+	if _, ok := p.(URLBuilder); !ok || args.Code == "" {
+		return nil
+	}
+	stateless := c.stateless[args.Type]
+	if args.State == "" {
+		if stateless {
+			return nil
+		}
+		return ErrStateRequired
+	}
+	err := c.consumeState(ctx, args)
+	// 兼容调用方自行生成的 state
+	if errors.Is(err, ErrInvalidState) && stateless {
+		return nil
+	}
+	return err
+}
+
+// consumeState 校验 state 并填充 PKCE 校验码和回调地址, state 只能使用一次
+func (c *Client) consumeState(ctx context.Context, args *AuthArgs) error {
+	key := stateKeyPrefix + args.State
+	// 先原子地标记为已使用, 并发重放同一个 state 时只有一个请求能通过
+	n, err := c.states.Incr(ctx, key+stateUsedSuffix, c.stateTTL)
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ErrInvalidState
+	}
+	var as authState
+	if err = c.states.Scan(ctx, key, &as); err != nil {
+		return ErrInvalidState
+	}
+	_ = c.states.Remove(ctx, key)
+	if as.Type != args.Type {
+		return ErrInvalidState
+	}
+	args.Verifier = as.Verifier
+	args.RedirectURL = as.Redirect
+	return nil
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// authCodeURL 基于 oauth2.Config 生成授权链接
+func authCodeURL(cfg *oauth2.Config, state, verifier, redirect string, pkce bool, opts ...oauth2.AuthCodeOption) string {
+	if pkce && verifier != "" {
+		opts = append(opts, oauth2.S256ChallengeOption(verifier))
+	}
+	if redirect != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("redirect_uri", redirect))
+	}
+	return cfg.AuthCodeURL(state, opts...)
+}
+
+// exchangeOptions 使用 code 换取 token 时需要带上的 PKCE 校验码和回调地址
+func exchangeOptions(args *AuthArgs, pkce bool) []oauth2.AuthCodeOption {
+	var opts []oauth2.AuthCodeOption
+	if pkce && args.Verifier != "" {
+		opts = append(opts, oauth2.VerifierOption(args.Verifier))
+	}
+	if args.RedirectURL != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("redirect_uri", args.RedirectURL))
+	}
+	return opts
+}
@@ -0,0 +1,130 @@
+package oauth2
+
+import (
+	"context"
+	"golang.org/x/oauth2"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type fakeProvider struct {
+	cfg  *oauth2.Config
+	args *AuthArgs
+}
+
+func (f *fakeProvider) AuthCodeURL(state, verifier, redirect string) string {
+	return authCodeURL(f.cfg, state, verifier, redirect, true)
+}
+
+func (f *fakeProvider) Authorize(_ context.Context, args *AuthArgs) (*oauth2.Token, *User, error) {
+	f.args = args
+	return &oauth2.Token{}, &User{ID: "1"}, nil
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	ctx := context.Background()
+	p := &fakeProvider{cfg: &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{AuthURL: "https://example.com/auth"},
+	}}
+	c := New()
+	c.register(TypeGoogle, p)
+
+	addr, err := c.AuthCodeURL(ctx, TypeGoogle, "https://example.com/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	state := q.Get("state")
+	if state == "" || q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		t.Fatal("invalid auth code url: " + addr)
+	}
+	if q.Get("redirect_uri") != "https://example.com/callback" {
+		t.Fatal("invalid redirect uri: " + q.Get("redirect_uri"))
+	}
+
+	// 未知的 state
+	if _, _, err = c.Authorize(ctx, &AuthArgs{Type: TypeGoogle, Code: "code", State: "unknown"}); err != ErrInvalidState {
+		t.Fatal("unknown state should be rejected")
+	}
+	args := &AuthArgs{Type: TypeGoogle, Code: "code", State: state}
+	if _, _, err = c.Authorize(ctx, args); err != nil {
+		t.Fatal(err)
+	}
+	if args.Verifier != "" {
+		t.Fatal("caller's args should not be modified")
+	}
+	if p.args.Verifier == "" || oauth2.S256ChallengeFromVerifier(p.args.Verifier) != q.Get("code_challenge") {
+		t.Fatal("invalid verifier")
+	}
+	if p.args.RedirectURL != "https://example.com/callback" {
+		t.Fatal("invalid redirect url")
+	}
+	// state 只能使用一次
+	if _, _, err = c.Authorize(ctx, &AuthArgs{Type: TypeGoogle, Code: "code", State: state}); err != ErrInvalidState {
+		t.Fatal("state should be consumed")
+	}
+}
+
+func TestStateRequired(t *testing.T) {
+	ctx := context.Background()
+	p := &fakeProvider{cfg: &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://example.com/auth"}}}
+	c := New()
+	c.register(TypeGoogle, p)
+
+	if _, _, err := c.Authorize(ctx, &AuthArgs{Type: TypeGoogle, Code: "code"}); err != ErrStateRequired {
+		t.Fatalf("missing state should be rejected, got %v", err)
+	}
+	// 直接传递 token 时没有 state
+	if _, _, err := c.Authorize(ctx, &AuthArgs{Type: TypeGoogle, Token: "token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.AllowStateless(TypeGoogle)
+	if _, _, err := c.Authorize(ctx, &AuthArgs{Type: TypeGoogle, Code: "code"}); err != nil {
+		t.Fatal(err)
+	}
+	// 调用方自行生成的 state
+	if _, _, err := c.Authorize(ctx, &AuthArgs{Type: TypeGoogle, Code: "code", State: "custom"}); err != nil {
+		t.Fatal(err)
+	}
+	if p.args.Verifier != "" {
+		t.Fatal("verifier should be empty")
+	}
+}
+
+func TestStateReplay(t *testing.T) {
+	ctx := context.Background()
+	p := &fakeProvider{cfg: &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://example.com/auth"}}}
+	c := New()
+	c.register(TypeGoogle, p)
+
+	addr, err := c.AuthCodeURL(ctx, TypeGoogle, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(addr)
+	state := u.Query().Get("state")
+
+	var wg sync.WaitGroup
+	var success atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := c.Authorize(ctx, &AuthArgs{Type: TypeGoogle, Code: "code", State: state}); err == nil {
+				success.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if success.Load() != 1 {
+		t.Fatalf("state should be consumed once, got %d", success.Load())
+	}
+}
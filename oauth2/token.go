@@ -0,0 +1,78 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var ErrNotSupported = errors.New("not supported by the oauth provider")
+
+// Refresher 支持使用 refresh token 换取新 token 的登录方式
+type Refresher interface {
+	Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error)
+}
+
+// Revoker 支持撤销授权的登录方式, 注销账号时需要调用
+type Revoker interface {
+	Revoke(ctx context.Context, token string) error
+}
+
+func (c *Client) Refresh(ctx context.Context, ot OauthType, refreshToken string) (*oauth2.Token, error) {
+	p, ok := c.providers[ot]
+	if !ok {
+		return nil, fmt.Errorf("not supported oauth type: %s", ot)
+	}
+	r, ok := p.(Refresher)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return r.Refresh(ctx, refreshToken)
+}
+
+func (c *Client) Revoke(ctx context.Context, ot OauthType, token string) error {
+	p, ok := c.providers[ot]
+	if !ok {
+		return fmt.Errorf("not supported oauth type: %s", ot)
+	}
+	r, ok := p.(Revoker)
+	if !ok {
+		return ErrNotSupported
+	}
+	return r.Revoke(ctx, token)
+}
+
+// refreshWithConfig 基于 oauth2.Config 刷新 token, 平台未返回新的 refresh token 时沿用旧值
+func refreshWithConfig(ctx context.Context, cfg *oauth2.Config, rt string) (*oauth2.Token, error) {
+	if rt == "" {
+		return nil, errors.New("refresh token is empty")
+	}
+	return cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: rt}).Token()
+}
+
+// revokeToken 调用撤销接口, clientID 不为空时使用 basic auth 认证
+func revokeToken(ctx context.Context, addr string, form url.Values, clientID, clientSecret string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("revoke token error, status: %d, body: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRefreshRevoke(t *testing.T) {
+	var revoked string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "rt" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "at2", "token_type": "Bearer", "expires_in": 3600})
+	})
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		revoked = r.FormValue("token")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	cfg := &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: srv.URL + "/token", AuthStyle: oauth2.AuthStyleInParams},
+	}
+	c := New()
+	c.Register(TypeDiscord, &discord{cfg: cfg})
+	c.Register(TypeWechat, &wechat{})
+
+	token, err := c.Refresh(ctx, TypeDiscord, "rt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at2" || token.RefreshToken != "rt" {
+		t.Fatalf("invalid token: %+v", token)
+	}
+	if _, err = c.Refresh(ctx, TypeWechat, "rt"); err != ErrNotSupported {
+		t.Fatal("wechat refresh should not be supported")
+	}
+
+	if err = revokeToken(ctx, srv.URL+"/revoke", url.Values{"token": {"at2"}}, "client", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if revoked != "at2" {
+		t.Fatal("token not revoked")
+	}
+	if err = revokeToken(ctx, srv.URL+"/revoke", url.Values{"token": {"at2"}}, "client", "wrong"); err == nil {
+		t.Fatal("revoke with wrong secret should fail")
+	}
+
+	// 使用 ctx 中注入的 http client 请求撤销接口
+	target, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: rewriteTransport{base: http.DefaultTransport, target: target}}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	if err = revokeToken(ctx, "https://revoke.example.com/revoke", url.Values{"token": {"at3"}}, "client", "secret"); err != nil || revoked != "at3" {
+		t.Fatalf("revoke should use the http client from ctx: %v", err)
+	}
+}
@@ -4,44 +4,57 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"github.com/dmzlingyin/utils/config"
 	"golang.org/x/oauth2"
+	"net/url"
 )
 
 const (
-	TwitterAuthURL  = "https://twitter.com/i/oauth2/authorize"
-	TwitterTokenURL = "https://api.twitter.com/2/oauth2/token"
-	TwitterUserURL  = "https://api.twitter.com/2/users/me?user.fields=profile_image_url"
+	TwitterAuthURL   = "https://twitter.com/i/oauth2/authorize"
+	TwitterTokenURL  = "https://api.twitter.com/2/oauth2/token"
+	TwitterUserURL   = "https://api.twitter.com/2/users/me?user.fields=profile_image_url"
+	TwitterRevokeURL = "https://api.twitter.com/2/oauth2/revoke"
 )
 
 const (
 	TwitterScopeUser  = "users.read"
 	TwitterScopeTweet = "tweet.read"
+	// 获取 refresh token 需要申请
+	TwitterScopeOffline = "offline.access"
 )
 
 func NewTwitter() Provider {
-	cfg := &oauth2.Config{
-		ClientID:     config.GetString("oauth2.twitter.client_id"),
-		ClientSecret: config.GetString("oauth2.twitter.client_secret"),
-		Endpoint: oauth2.Endpoint{
-			AuthURL:   TwitterAuthURL,
-			TokenURL:  TwitterTokenURL,
-			AuthStyle: oauth2.AuthStyleInParams,
-		},
-		RedirectURL: config.GetString("oauth2.twitter.redirect_url"),
-		Scopes:      []string{TwitterScopeUser, TwitterScopeTweet},
-	}
+	return must(NewTwitterWith(configOptions("oauth2.twitter")...))
+}
 
-	return &twitter{cfg: cfg}
+func NewTwitterWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts, TwitterScopeUser, TwitterScopeTweet, TwitterScopeOffline)
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL:   TwitterAuthURL,
+		TokenURL:  TwitterTokenURL,
+		UserURL:   TwitterUserURL,
+		RevokeURL: TwitterRevokeURL,
+	})
+	return &twitter{
+		cfg: o.oauth2Config(ep.AuthURL, ep.TokenURL),
+		ep:  ep,
+	}, nil
 }
 
 type twitter struct {
 	cfg *oauth2.Config
+	ep  Endpoints
+}
+
+func (d *twitter) AuthCodeURL(state, verifier, redirect string) string {
+	return authCodeURL(d.cfg, state, verifier, redirect, true)
 }
 
 func (d *twitter) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
-	opt := oauth2.VerifierOption("challenge")
-	token, err = d.cfg.Exchange(ctx, args.Code, opt)
+	// Twitter 强制 PKCE, 需要通过 Client.AuthCodeURL 发起授权
+	if args.Verifier == "" {
+		return nil, nil, errors.New("twitter: missing PKCE verifier")
+	}
+	token, err = d.cfg.Exchange(ctx, args.Code, exchangeOptions(args, true)...)
 	if err != nil {
 		return
 	} else if !token.Valid() {
@@ -49,7 +62,7 @@ func (d *twitter) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.
 		return
 	}
 
-	res, err := d.cfg.Client(ctx, token).Get(TwitterUserURL)
+	res, err := d.cfg.Client(ctx, token).Get(d.ep.UserURL)
 	if err != nil {
 		return
 	}
@@ -75,3 +88,11 @@ func (d *twitter) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.
 		Avatar:   u.Data.Avatar,
 	}, nil
 }
+
+func (d *twitter) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return refreshWithConfig(ctx, d.cfg, refreshToken)
+}
+
+func (d *twitter) Revoke(ctx context.Context, token string) error {
+	return revokeToken(ctx, d.ep.RevokeURL, url.Values{"token": {token}}, d.cfg.ClientID, d.cfg.ClientSecret)
+}
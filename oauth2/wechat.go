@@ -9,13 +9,29 @@ import (
 	"github.com/dmzlingyin/utils/config"
 	"golang.org/x/oauth2"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
 type WechatLoginResp struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	OpenId       string `json:"openid"`
+	SessionKey   string `json:"session_key"`
+	UnionId      string `json:"unionid"`
+	ErrCode      int    `json:"errcode"`
+	ErrMsg       string `json:"errmsg"`
+}
+
+type WechatUserInfo struct {
 	OpenId     string `json:"openid"`
-	SessionKey string `json:"session_key"`
 	UnionId    string `json:"unionid"`
+	Nickname   string `json:"nickname"`
+	HeadImgURL string `json:"headimgurl"`
 	ErrCode    int    `json:"errcode"`
 	ErrMsg     string `json:"errmsg"`
 }
@@ -32,58 +48,194 @@ type phoneInfo struct {
 	CountryCode     string `json:"countryCode"`
 }
 
+const (
+	WechatAuthURL = "https://open.weixin.qq.com/connect/qrconnect"
+	WechatAPIURL  = "https://api.weixin.qq.com"
+)
+
+// NewWechat 网站应用/移动应用/公众号的网页授权登录
 func NewWechat() Provider {
-	appid := config.GetString("oauth2.wechat.app_id")
-	secret := config.GetString("oauth2.wechat.app_secret")
-	if appid == "" || secret == "" {
-		panic("the appid or secret of wechat get failed")
+	return must(NewWechatWith(wechatConfigOptions("oauth2.wechat")...))
+}
+
+// NewWechatMini 小程序登录, 客户端通过 wx.login 获取 code
+func NewWechatMini() Provider {
+	return must(NewWechatMiniWith(wechatConfigOptions("oauth2.wechat_mini")...))
+}
+
+func NewWechatWith(opts ...Option) (Provider, error) {
+	return newWechat(newOptions(opts), false)
+}
+
+func NewWechatMiniWith(opts ...Option) (Provider, error) {
+	return newWechat(newOptions(opts), true)
+}
+
+func wechatConfigOptions(prefix string) []Option {
+	return []Option{
+		ClientID(config.GetString(prefix + ".app_id")),
+		ClientSecret(config.GetString(prefix + ".app_secret")),
+		RedirectURL(config.GetString(prefix + ".redirect_url")),
 	}
-	return &wechat{
-		appid:  appid,
-		secret: secret,
+}
+
+func newWechat(o *providerOptions, mini bool) (*wechat, error) {
+	if o.clientID == "" || o.clientSecret == "" {
+		return nil, errors.New("the appid or secret of wechat get failed")
 	}
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL: WechatAuthURL,
+		APIURL:  WechatAPIURL,
+	})
+	return &wechat{
+		appid:       o.clientID,
+		secret:      o.clientSecret,
+		redirectURL: o.redirectURL,
+		mini:        mini,
+		authURL:     ep.AuthURL,
+		apiURL:      ep.APIURL,
+	}, nil
 }
 
 type wechat struct {
-	appid  string
-	secret string
+	appid       string
+	secret      string
+	redirectURL string
+	mini        bool
+	authURL     string
+	apiURL      string
+
+	// 接口调用凭证, 有效期 2 小时且每日获取次数有限, 需要缓存
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
 }
 
-func (w *wechat) Authorize(ctx context.Context, args *AuthArgs) (*oauth2.Token, *User, error) {
-	url := "https://api.weixin.qq.com/sns/oauth2/access_token?appid=%s&secret=%s&code=%s&grant_type=authorization_code"
-	url = fmt.Sprintf(url, w.appid, w.secret, args.Code)
+// AuthCodeURL 网站应用扫码登录链接, 微信不支持 PKCE
+func (w *wechat) AuthCodeURL(state, _, redirect string) string {
+	if w.mini {
+		return ""
+	}
+	if redirect == "" {
+		redirect = w.redirectURL
+	}
+	q := url.Values{}
+	q.Set("appid", w.appid)
+	q.Set("redirect_uri", redirect)
+	q.Set("response_type", "code")
+	q.Set("scope", "snsapi_login")
+	q.Set("state", state)
+	return w.authURL + "?" + q.Encode() + "#wechat_redirect"
+}
 
-	resp, err := http.Get(url)
+// Authorize 传递了 PCode 时会同时获取用户手机号(仅小程序)
+func (w *wechat) Authorize(ctx context.Context, args *AuthArgs) (token *oauth2.Token, user *User, err error) {
+	if w.mini {
+		token, user, err = w.authorizeMini(ctx, args.Code)
+	} else {
+		token, user, err = w.authorizeOauth(ctx, args.Code)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
-	defer resp.Body.Close()
+
+	// 手机号接口仅对小程序开放, 其他登录方式忽略 PCode
+	if w.mini && args.PCode != "" {
+		if user.Phone, err = w.getPhoneNumber(ctx, args.PCode); err != nil {
+			return nil, nil, err
+		}
+	}
+	return token, user, nil
+}
+
+func (w *wechat) authorizeOauth(ctx context.Context, code string) (*oauth2.Token, *User, error) {
+	q := url.Values{}
+	q.Set("appid", w.appid)
+	q.Set("secret", w.secret)
+	q.Set("code", code)
+	q.Set("grant_type", "authorization_code")
 
 	var wResp WechatLoginResp
-	if err = json.NewDecoder(resp.Body).Decode(&wResp); err != nil {
+	if err := w.get(ctx, "/sns/oauth2/access_token?"+q.Encode(), &wResp); err != nil {
 		return nil, nil, err
 	}
 	// 判断微信接口返回的是否是一个异常情况
 	if wResp.ErrCode != 0 {
 		return nil, nil, errors.New(wResp.ErrMsg)
 	}
+	token := &oauth2.Token{
+		AccessToken:  wResp.AccessToken,
+		RefreshToken: wResp.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(wResp.ExpiresIn) * time.Second),
+	}
 	user := &User{
-		ID: wResp.OpenId,
+		ID:      wResp.OpenId,
+		UnionID: wResp.UnionId,
+	}
+
+	// snsapi_base 只能获取 openid
+	if !strings.Contains(wResp.Scope, "snsapi_userinfo") && !strings.Contains(wResp.Scope, "snsapi_login") {
+		return token, user, nil
+	}
+	info, err := w.getUserInfo(ctx, wResp.AccessToken, wResp.OpenId)
+	if err != nil {
+		return nil, nil, err
+	}
+	user.Username = info.Nickname
+	user.Avatar = info.HeadImgURL
+	if user.UnionID == "" {
+		user.UnionID = info.UnionId
+	}
+	return token, user, nil
+}
+
+func (w *wechat) getUserInfo(ctx context.Context, accessToken, openid string) (*WechatUserInfo, error) {
+	q := url.Values{}
+	q.Set("access_token", accessToken)
+	q.Set("openid", openid)
+
+	var info WechatUserInfo
+	if err := w.get(ctx, "/sns/userinfo?"+q.Encode(), &info); err != nil {
+		return nil, err
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.New(info.ErrMsg)
+	}
+	return &info, nil
+}
+
+// authorizeMini 小程序使用 code 换取 openid/unionid/session_key, session_key 通过 token 的 Extra 返回
+func (w *wechat) authorizeMini(ctx context.Context, code string) (*oauth2.Token, *User, error) {
+	q := url.Values{}
+	q.Set("appid", w.appid)
+	q.Set("secret", w.secret)
+	q.Set("js_code", code)
+	q.Set("grant_type", "authorization_code")
+
+	var wResp WechatLoginResp
+	if err := w.get(ctx, "/sns/jscode2session?"+q.Encode(), &wResp); err != nil {
+		return nil, nil, err
+	}
+	if wResp.ErrCode != 0 {
+		return nil, nil, errors.New(wResp.ErrMsg)
 	}
 
 	token := &oauth2.Token{
 		Expiry: time.Now().Add(time.Hour * 24),
 	}
-	return token, user, nil
+	return token.WithExtra(map[string]any{"session_key": wResp.SessionKey}), &User{
+		ID:      wResp.OpenId,
+		UnionID: wResp.UnionId,
+	}, nil
 }
 
-func (w *wechat) getPhoneNumber(code string) (string, error) {
-	ac, err := w.getAccessToken()
+func (w *wechat) getPhoneNumber(ctx context.Context, code string) (string, error) {
+	ac, err := w.getAccessToken(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	url := "https://api.weixin.qq.com/wxa/business/getuserphonenumber?access_token=" + ac
+	addr := w.apiURL + "/wxa/business/getuserphonenumber?access_token=" + url.QueryEscape(ac)
 	scode := struct {
 		Code string `json:"code"`
 	}{code}
@@ -93,12 +245,12 @@ func (w *wechat) getPhoneNumber(code string) (string, error) {
 		return "", err
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", url, bytes.NewReader(buffer))
+	req, err := http.NewRequestWithContext(ctx, "POST", addr, bytes.NewReader(buffer))
 	if err != nil {
 		return "", err
 	}
-	resp, err := client.Do(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient(ctx).Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -109,29 +261,45 @@ func (w *wechat) getPhoneNumber(code string) (string, error) {
 	if err = decoder.Decode(&phone); err != nil {
 		return "", err
 	}
+	if phone.ErrCode != 0 {
+		return "", fmt.Errorf("get wechat phone number error: %d %s", phone.ErrCode, phone.ErrMsg)
+	}
 	return phone.PhoneInfo.PhoneNumber, nil
 }
 
-func (w *wechat) getAccessToken() (string, error) {
+func (w *wechat) getAccessToken(ctx context.Context) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.accessToken != "" && time.Now().Before(w.expiry) {
+		return w.accessToken, nil
+	}
+
 	// access token
 	type AT struct {
 		AccessToken string `json:"access_token"`
-		ExpiresIn   int32  `json:"expires_int"`
+		ExpiresIn   int64  `json:"expires_in"`
+		ErrCode     int    `json:"errcode"`
+		ErrMsg      string `json:"errmsg"`
 	}
 
-	url := "https://api.weixin.qq.com/cgi-bin/token?grant_type=client_credential"
-	url = fmt.Sprintf("%s&appid=%s&secret=%s", url, w.appid, w.secret)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+	q := url.Values{}
+	q.Set("grant_type", "client_credential")
+	q.Set("appid", w.appid)
+	q.Set("secret", w.secret)
 
 	var at AT
-	decoder := json.NewDecoder(resp.Body)
-	if err = decoder.Decode(&at); err != nil {
+	if err := w.get(ctx, "/cgi-bin/token?"+q.Encode(), &at); err != nil {
 		return "", err
 	}
-	return at.AccessToken, nil
+	if at.ErrCode != 0 {
+		return "", errors.New(at.ErrMsg)
+	}
+	w.accessToken = at.AccessToken
+	// 提前 5 分钟过期, 避免临界时刻失效
+	w.expiry = time.Now().Add(time.Duration(at.ExpiresIn)*time.Second - 5*time.Minute)
+	return w.accessToken, nil
+}
+
+func (w *wechat) get(ctx context.Context, path string, v any) error {
+	return getJSON(ctx, w.apiURL+path, v)
 }
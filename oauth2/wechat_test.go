@@ -0,0 +1,64 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWechatFlows(t *testing.T) {
+	var tokenCalls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sns/oauth2/access_token", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "at", "expires_in": 7200, "refresh_token": "rt",
+			"openid": "o1", "scope": "snsapi_login",
+		})
+	})
+	mux.HandleFunc("/sns/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"openid": "o1", "unionid": "u1", "nickname": "nick", "headimgurl": "https://img",
+		})
+	})
+	mux.HandleFunc("/sns/jscode2session", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"openid": "o2", "unionid": "u1", "session_key": "sk"})
+	})
+	mux.HandleFunc("/cgi-bin/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenCalls++
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "cat", "expires_in": 7200})
+	})
+	mux.HandleFunc("/wxa/business/getuserphonenumber", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"phone_info": map[string]string{"phoneNumber": "13800000000"}})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	web := &wechat{appid: "a", secret: "s", apiURL: srv.URL}
+	token, user, err := web.Authorize(ctx, &AuthArgs{Type: TypeWechat, Code: "c", PCode: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" || user.ID != "o1" || user.UnionID != "u1" || user.Username != "nick" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+	if user.Phone != "" || tokenCalls != 0 {
+		t.Fatal("phone number is only for mini program")
+	}
+
+	mini := &wechat{appid: "a", secret: "s", apiURL: srv.URL, mini: true}
+	for i := 0; i < 2; i++ {
+		token, user, err = mini.Authorize(ctx, &AuthArgs{Type: TypeWechatMini, Code: "c", PCode: "p"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if token.Extra("session_key") != "sk" || user.ID != "o2" || user.UnionID != "u1" || user.Phone != "13800000000" {
+		t.Fatalf("invalid user: %+v", user)
+	}
+	if tokenCalls != 1 {
+		t.Fatalf("access token should be cached, calls: %d", tokenCalls)
+	}
+}
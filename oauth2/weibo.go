@@ -0,0 +1,84 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dmzlingyin/utils/cast"
+	"golang.org/x/oauth2"
+	"net/url"
+)
+
+const (
+	WeiboAuthURL  = "https://api.weibo.com/oauth2/authorize"
+	WeiboTokenURL = "https://api.weibo.com/oauth2/access_token"
+	WeiboUserURL  = "https://api.weibo.com/2/users/show.json"
+)
+
+func NewWeibo() Provider {
+	return must(NewWeiboWith(configOptions("oauth2.weibo")...))
+}
+
+func NewWeiboWith(opts ...Option) (Provider, error) {
+	o := newOptions(opts)
+	ep := o.resolveEndpoints(Endpoints{
+		AuthURL:  WeiboAuthURL,
+		TokenURL: WeiboTokenURL,
+		UserURL:  WeiboUserURL,
+	})
+	return &weibo{
+		cfg: o.oauth2Config(ep.AuthURL, ep.TokenURL),
+		ep:  ep,
+	}, nil
+}
+
+type weibo struct {
+	cfg *oauth2.Config
+	ep  Endpoints
+}
+
+func (w *weibo) AuthCodeURL(state, verifier, redirect string) string {
+	return authCodeURL(w.cfg, state, verifier, redirect, false)
+}
+
+func (w *weibo) Authorize(ctx context.Context, args *AuthArgs) (*oauth2.Token, *User, error) {
+	token, err := w.cfg.Exchange(ctx, args.Code, exchangeOptions(args, false)...)
+	if err != nil {
+		return nil, nil, err
+	} else if !token.Valid() {
+		return nil, nil, errors.New("invalid token")
+	}
+
+	// uid 随 token 一起返回
+	uid := cast.ToString(token.Extra("uid"))
+	if uid == "" {
+		return nil, nil, errors.New("weibo uid not found")
+	}
+	v := url.Values{}
+	v.Set("access_token", token.AccessToken)
+	v.Set("uid", uid)
+	var u struct {
+		IDStr           string `json:"idstr"`
+		ScreenName      string `json:"screen_name"`
+		AvatarLarge     string `json:"avatar_large"`
+		ProfileImageURL string `json:"profile_image_url"`
+		ErrorCode       int    `json:"error_code"`
+		Error           string `json:"error"`
+	}
+	if err = getJSON(ctx, w.ep.UserURL+"?"+v.Encode(), &u); err != nil {
+		return nil, nil, err
+	}
+	if u.ErrorCode != 0 {
+		return nil, nil, fmt.Errorf("weibo error: %d %s", u.ErrorCode, u.Error)
+	}
+
+	avatar := u.AvatarLarge
+	if avatar == "" {
+		avatar = u.ProfileImageURL
+	}
+	return token, &User{
+		ID:       u.IDStr,
+		Username: u.ScreenName,
+		Avatar:   avatar,
+	}, nil
+}
@@ -41,7 +41,10 @@ func NewAlipay() (*Alipay, error) {
 	}, nil
 }
 
-func (p *Alipay) Pay(req *AliPayReq) (string, error) {
+func (p *Alipay) Pay(req *AliPayReq) (res string, err error) {
+	rec := newAudit(ProviderAlipay, AuditOutbound, "pay", req.OutTradeNo, req)
+	defer func() { rec.finish(context.Background(), nil, err) }()
+
 	return p.client.TradeAppPay(alipay.TradeAppPay{Trade: alipay.Trade{
 		NotifyURL:   req.NotifyURL,
 		ReturnURL:   req.ReturnURL,
@@ -51,18 +54,24 @@ func (p *Alipay) Pay(req *AliPayReq) (string, error) {
 	}})
 }
 
-func (p *Alipay) Query(ctx context.Context, outTradeNo string) (*QueryRes, error) {
-	res, err := p.client.TradeQuery(ctx, alipay.TradeQuery{OutTradeNo: outTradeNo})
+func (p *Alipay) Query(ctx context.Context, outTradeNo string) (res *QueryRes, err error) {
+	rec := newAudit(ProviderAlipay, AuditOutbound, "query", outTradeNo, nil)
+	defer func() { rec.finish(ctx, res, err) }()
+
+	rsp, err := p.client.TradeQuery(ctx, alipay.TradeQuery{OutTradeNo: outTradeNo})
 	if err != nil {
 		return nil, err
 	}
-	return (*QueryRes)(res), nil
+	return (*QueryRes)(rsp), nil
 }
 
-func (p *Alipay) ParseNotify(value url.Values) (*AlipayNotification, error) {
-	res, err := p.client.DecodeNotification(value)
+func (p *Alipay) ParseNotify(value url.Values) (res *AlipayNotification, err error) {
+	rec := newAudit(ProviderAlipay, AuditInbound, "notify", value.Get("out_trade_no"), value)
+	defer func() { rec.finish(context.Background(), res, err) }()
+
+	n, err := p.client.DecodeNotification(value)
 	if err != nil {
 		return nil, err
 	}
-	return (*AlipayNotification)(res), nil
+	return (*AlipayNotification)(n), nil
 }
@@ -3,10 +3,12 @@ package payment
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/awa/go-iap/appstore"
 	"github.com/awa/go-iap/appstore/api"
 	"github.com/dmzlingyin/utils/config"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -15,11 +17,18 @@ type VerifyApplePayArgs struct {
 }
 
 type VerifyApplePayRes struct {
-	Sandbox       bool      // 是否为沙盒环境
-	TransactionID string    // 交易ID
-	ProductID     string    // 产品ID
-	StartTime     time.Time // 订阅开始时间
-	ExpiryTime    time.Time // 订阅到期时间
+	Sandbox               bool      // 是否为沙盒环境
+	TransactionID         string    // 交易ID
+	OriginalTransactionID string    // 原始交易ID
+	ProductID             string    // 产品ID
+	StartTime             time.Time // 订阅开始时间
+	ExpiryTime            time.Time // 订阅到期时间
+	AutoRenew             bool      // 是否自动续订(仅收据验证时返回)
+}
+
+type VerifyReceiptArgs struct {
+	Receipt   string // 客户端上传的 base64 收据(ReceiptData)
+	ProductID string // 产品ID, 为空时取最近的一笔交易
 }
 
 type ApplePayNotification struct {
@@ -36,6 +45,7 @@ type ApplePayNotification struct {
 type ApplePay struct {
 	apiClient      *api.StoreClient
 	appstoreClient *appstore.Client
+	sharedSecret   string
 }
 
 func NewApplePay() (*ApplePay, error) {
@@ -53,10 +63,14 @@ func NewApplePay() (*ApplePay, error) {
 	return &ApplePay{
 		apiClient:      api.NewStoreClient(cfg),
 		appstoreClient: appstore.New(),
+		sharedSecret:   config.GetString("pay.apple.shared_secret"),
 	}, nil
 }
 
-func (a *ApplePay) Verify(ctx context.Context, args *VerifyApplePayArgs) (*VerifyApplePayRes, error) {
+func (a *ApplePay) Verify(ctx context.Context, args *VerifyApplePayArgs) (res *VerifyApplePayRes, err error) {
+	rec := newAudit(ProviderApple, AuditOutbound, "verify", args.TransactionID, args)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	rsp, err := a.apiClient.GetTransactionInfo(ctx, args.TransactionID)
 	if err != nil {
 		return nil, err
@@ -67,15 +81,87 @@ func (a *ApplePay) Verify(ctx context.Context, args *VerifyApplePayArgs) (*Verif
 	}
 	// 包装结果
 	return &VerifyApplePayRes{
-		Sandbox:       transaction.Environment == api.Sandbox,
-		TransactionID: transaction.TransactionID,
-		ProductID:     transaction.ProductID,
-		StartTime:     time.UnixMilli(transaction.PurchaseDate),
-		ExpiryTime:    time.UnixMilli(transaction.ExpiresDate),
+		Sandbox:               transaction.Environment == api.Sandbox,
+		TransactionID:         transaction.TransactionID,
+		OriginalTransactionID: transaction.OriginalTransactionId,
+		ProductID:             transaction.ProductID,
+		StartTime:             time.UnixMilli(transaction.PurchaseDate),
+		ExpiryTime:            time.UnixMilli(transaction.ExpiresDate),
 	}, nil
 }
 
-func (a *ApplePay) ParseNotify(ctx context.Context, body []byte) (*ApplePayNotification, error) {
+// VerifyReceipt 通过 verifyReceipt 接口验证旧版客户端上传的收据, 生产环境返回 21007 时自动转到沙盒环境重试
+func (a *ApplePay) VerifyReceipt(ctx context.Context, args *VerifyReceiptArgs) (res *VerifyApplePayRes, err error) {
+	rec := newAudit(ProviderApple, AuditOutbound, "verify_receipt", "", args)
+	defer func() {
+		if res != nil {
+			rec.setOrderID(res.OriginalTransactionID)
+		}
+		rec.finish(ctx, res, err)
+	}()
+
+	req := appstore.IAPRequest{
+		ReceiptData:            args.Receipt,
+		Password:               a.sharedSecret,
+		ExcludeOldTransactions: true,
+	}
+	var resp appstore.IAPResponse
+	if err := a.appstoreClient.Verify(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	if err := appstore.HandleError(resp.Status); err != nil {
+		return nil, err
+	}
+
+	// 优先使用 latest_receipt_info, 非订阅类收据只有 receipt.in_app
+	items := resp.LatestReceiptInfo
+	if len(items) == 0 {
+		items = resp.Receipt.InApp
+	}
+	var latest *appstore.InApp
+	for i := range items {
+		item := &items[i]
+		// 已退款的交易跳过
+		if item.CancellationDateMS != "" {
+			continue
+		}
+		if args.ProductID != "" && item.ProductID != args.ProductID {
+			continue
+		}
+		if latest == nil || parseAppleMS(item.PurchaseDateMS).After(parseAppleMS(latest.PurchaseDateMS)) {
+			latest = item
+		}
+	}
+	if latest == nil {
+		return nil, errors.New("no valid transaction in receipt")
+	}
+
+	res = &VerifyApplePayRes{
+		Sandbox:               resp.Environment == appstore.Sandbox,
+		TransactionID:         latest.TransactionID,
+		OriginalTransactionID: string(latest.OriginalTransactionID),
+		ProductID:             latest.ProductID,
+		StartTime:             parseAppleMS(latest.PurchaseDateMS),
+		ExpiryTime:            parseAppleMS(latest.ExpiresDateMS),
+	}
+	for _, info := range resp.PendingRenewalInfo {
+		if info.OriginalTransactionID == res.OriginalTransactionID {
+			res.AutoRenew = info.SubscriptionAutoRenewStatus == "1"
+			break
+		}
+	}
+	return res, nil
+}
+
+func (a *ApplePay) ParseNotify(ctx context.Context, body []byte) (res *ApplePayNotification, err error) {
+	rec := newAudit(ProviderApple, AuditInbound, "notify", "", body)
+	defer func() {
+		if res != nil {
+			rec.setOrderID(res.OriginalTransactionID)
+		}
+		rec.finish(ctx, res, err)
+	}()
+
 	var signedPayload appstore.SubscriptionNotificationV2SignedPayload
 	if err := json.Unmarshal(body, &signedPayload); err != nil {
 		return nil, err
@@ -101,3 +187,12 @@ func (a *ApplePay) ParseNotify(ctx context.Context, body []byte) (*ApplePayNotif
 		Sandbox:               tp.Environment == appstore.Sandbox,
 	}, nil
 }
+
+// parseAppleMS 解析 verifyReceipt 返回的毫秒时间戳字符串
+func parseAppleMS(ms string) time.Time {
+	v, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil || v <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(v)
+}
@@ -2,7 +2,11 @@ package payment
 
 import (
 	"context"
+	"github.com/awa/go-iap/appstore"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestAppleParseNotify(t *testing.T) {
@@ -14,3 +18,34 @@ func TestAppleParseNotify(t *testing.T) {
 	}
 	t.Log(res)
 }
+
+func TestAppleVerifyReceipt(t *testing.T) {
+	body := `{"status":0,"environment":"Sandbox","latest_receipt_info":[` +
+		`{"product_id":"vip_month","transaction_id":"1001","original_transaction_id":"1000","purchase_date_ms":"1700000000000","expires_date_ms":"1702592000000"},` +
+		`{"product_id":"vip_month","transaction_id":"1002","original_transaction_id":"1000","purchase_date_ms":"1702592000000","expires_date_ms":"1705270400000"}],` +
+		`"pending_renewal_info":[{"original_transaction_id":"1000","auto_renew_status":"1","product_id":"vip_month"}]}`
+	sandbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer sandbox.Close()
+	production := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":21007}`))
+	}))
+	defer production.Close()
+
+	client := appstore.NewWithClient(http.DefaultClient)
+	client.ProductionURL = production.URL
+	client.SandboxURL = sandbox.URL
+	ap := &ApplePay{appstoreClient: client}
+
+	res, err := ap.VerifyReceipt(context.Background(), &VerifyReceiptArgs{Receipt: "xxx", ProductID: "vip_month"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Sandbox || res.TransactionID != "1002" || res.OriginalTransactionID != "1000" || !res.AutoRenew {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if !res.ExpiryTime.Equal(time.UnixMilli(1705270400000)) {
+		t.Fatalf("unexpected expiry time: %s", res.ExpiryTime)
+	}
+}
@@ -0,0 +1,252 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dmzlingyin/utils/log"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 审计记录中的平台标识
+const (
+	ProviderApple    = "apple"
+	ProviderGoogle   = "google"
+	ProviderHuawei   = "huawei"
+	ProviderAlipay   = "alipay"
+	ProviderWechat   = "wechat"
+	ProviderStripe   = "stripe"
+	ProviderPaypal   = "paypal"
+	ProviderDouyin   = "douyin"
+	ProviderKuaishou = "kuaishou"
+)
+
+const (
+	AuditOutbound = "outbound" // 调用第三方平台
+	AuditInbound  = "inbound"  // 第三方平台回调
+
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+
+	auditRedacted = "***"
+)
+
+// AuditRecord 一次第三方调用或回调的审计记录
+type AuditRecord struct {
+	Time      time.Time     `json:"time" bson:"time"`
+	Provider  string        `json:"provider" bson:"provider"`
+	Direction string        `json:"direction" bson:"direction"`
+	Action    string        `json:"action" bson:"action"`
+	OrderID   string        `json:"orderId" bson:"order_id"`
+	Outcome   string        `json:"outcome" bson:"outcome"`
+	Error     string        `json:"error,omitempty" bson:"error,omitempty"`
+	Duration  time.Duration `json:"duration" bson:"duration"`
+	Request   any           `json:"request,omitempty" bson:"request,omitempty"`
+	Response  any           `json:"response,omitempty" bson:"response,omitempty"`
+
+	sink AuditSink // 开始记录时的 sink, 期间调用 SetAuditSink 不影响本条记录
+}
+
+// AuditSink 审计记录的存储
+type AuditSink interface {
+	Write(ctx context.Context, record *AuditRecord) error
+}
+
+var (
+	// auditMu 保护 auditSink 及 auditRedactKeys, 请求处理过程中会并发读取
+	auditMu   sync.RWMutex
+	auditSink AuditSink
+	// 需要脱敏的字段, 比较时忽略大小写、下划线和中划线
+	auditRedactKeys = map[string]bool{
+		"receipt":       true,
+		"receiptdata":   true,
+		"latestreceipt": true,
+		"signedpayload": true,
+		"sign":          true,
+		"paysign":       true,
+		"openid":        true,
+		"payer":         true,
+		"email":         true,
+		"phone":         true,
+	}
+	// 字段名包含以下片段时同样脱敏
+	auditRedactParts = []string{"token", "secret", "password", "signature", "privatekey", "signedtransaction", "signedrenewal"}
+)
+
+// SetAuditSink 开启审计, sink 为 nil 时关闭
+func SetAuditSink(sink AuditSink) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditSink = sink
+}
+
+// AddAuditRedactKeys 追加需要脱敏的字段
+func AddAuditRedactKeys(keys ...string) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	for _, k := range keys {
+		auditRedactKeys[normalizeAuditKey(k)] = true
+	}
+}
+
+// newAudit 开始一条审计记录, 未开启审计时返回 nil
+func newAudit(provider, direction, action, orderID string, req any) *AuditRecord {
+	auditMu.RLock()
+	sink := auditSink
+	auditMu.RUnlock()
+	if sink == nil {
+		return nil
+	}
+	return &AuditRecord{
+		sink:      sink,
+		Time:      time.Now(),
+		Provider:  provider,
+		Direction: direction,
+		Action:    action,
+		OrderID:   orderID,
+		Request:   redact(req),
+	}
+}
+
+// finish 结束并写入审计记录, 写入失败只记录日志, 不影响支付流程
+func (r *AuditRecord) finish(ctx context.Context, resp any, err error) {
+	if r == nil {
+		return
+	}
+	r.Duration = time.Since(r.Time)
+	r.Outcome = AuditSuccess
+	if err != nil {
+		r.Outcome = AuditFailure
+		r.Error = err.Error()
+	} else {
+		r.Response = redact(resp)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if e := r.sink.Write(ctx, r); e != nil {
+		log.Errorf("write payment audit record error: %s", e)
+	}
+}
+
+// setOrderID 回调解析完成后才能拿到订单号
+func (r *AuditRecord) setOrderID(orderID string) {
+	if r != nil && orderID != "" {
+		r.OrderID = orderID
+	}
+}
+
+// setRequest 部分回调需要解码后才能按字段脱敏
+func (r *AuditRecord) setRequest(req any) {
+	if r != nil {
+		r.Request = redact(req)
+	}
+}
+
+// redact 将请求或响应转换为通用结构并对敏感字段脱敏
+func redact(v any) any {
+	if v == nil {
+		return nil
+	}
+	var data []byte
+	switch val := v.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil
+		}
+	}
+
+	var res any
+	if err := json.Unmarshal(data, &res); err != nil {
+		// 非 JSON 内容无法按字段脱敏, 只保留长度
+		return map[string]any{"size": len(data)}
+	}
+	return redactValue(res)
+}
+
+func redactValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			if isAuditRedactKey(k) {
+				val[k] = auditRedacted
+			} else {
+				val[k] = redactValue(item)
+			}
+		}
+	case []any:
+		for i, item := range val {
+			val[i] = redactValue(item)
+		}
+	}
+	return v
+}
+
+func isAuditRedactKey(key string) bool {
+	key = normalizeAuditKey(key)
+	auditMu.RLock()
+	ok := auditRedactKeys[key]
+	auditMu.RUnlock()
+	if ok {
+		return true
+	}
+	for _, part := range auditRedactParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeAuditKey(key string) string {
+	key = strings.ToLower(key)
+	key = strings.ReplaceAll(key, "_", "")
+	return strings.ReplaceAll(key, "-", "")
+}
+
+// NewMongoAuditSink 将审计记录写入 MongoDB 集合
+func NewMongoAuditSink(db *mongo.Database, collection string) AuditSink {
+	return &mongoAuditSink{coll: db.Collection(collection)}
+}
+
+type mongoAuditSink struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoAuditSink) Write(ctx context.Context, record *AuditRecord) error {
+	_, err := s.coll.InsertOne(ctx, record)
+	return err
+}
+
+// NewFileAuditSink 将审计记录以 JSON Lines 格式追加写入日志文件
+func NewFileAuditSink(path string) (AuditSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditSink{f: f}, nil
+}
+
+type fileAuditSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (s *fileAuditSink) Write(_ context.Context, record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
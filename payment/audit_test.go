@@ -0,0 +1,80 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	records []*AuditRecord
+}
+
+func (s *memoryAuditSink) Write(_ context.Context, record *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	sink := &memoryAuditSink{}
+	SetAuditSink(sink)
+	defer SetAuditSink(nil)
+
+	rec := newAudit(ProviderGoogle, AuditOutbound, "verify", "", &VerifyGooglePayArgs{
+		PackageName:   "com.example.app",
+		PurchaseToken: "secret-token",
+	})
+	rec.setOrderID("GPA.1234")
+	rec.finish(context.Background(), nil, errors.New("boom"))
+
+	if len(sink.records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(sink.records))
+	}
+	r := sink.records[0]
+	if r.OrderID != "GPA.1234" || r.Outcome != AuditFailure || r.Error != "boom" {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+	req := r.Request.(map[string]any)
+	if req["PurchaseToken"] != auditRedacted || req["PackageName"] != "com.example.app" {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+
+	// 嵌套字段同样需要脱敏
+	v := redact([]byte(`{"data":{"receipt-data":"xxx","items":[{"access_token":"xxx","product_id":"vip"}]}}`))
+	data := v.(map[string]any)["data"].(map[string]any)
+	item := data["items"].([]any)[0].(map[string]any)
+	if data["receipt-data"] != auditRedacted || item["access_token"] != auditRedacted || item["product_id"] != "vip" {
+		t.Fatalf("unexpected redact result: %+v", v)
+	}
+
+	// 未开启审计时不产生记录
+	SetAuditSink(nil)
+	if rec = newAudit(ProviderGoogle, AuditOutbound, "verify", "", nil); rec != nil {
+		t.Fatal("audit should be disabled")
+	}
+	rec.finish(context.Background(), nil, nil)
+}
+
+// 请求处理过程中修改配置不应产生数据竞争, 需配合 -race 运行
+func TestAuditConcurrent(t *testing.T) {
+	defer SetAuditSink(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetAuditSink(&memoryAuditSink{})
+			AddAuditRedactKeys("card_no")
+		}()
+		go func() {
+			defer wg.Done()
+			rec := newAudit(ProviderStripe, AuditOutbound, "create", "", map[string]any{"card_no": "4242"})
+			rec.finish(context.Background(), nil, nil)
+		}()
+	}
+	wg.Wait()
+}
@@ -106,7 +106,10 @@ func newDouyinPay(options map[string]string) *DouyinPay {
 	}
 }
 
-func (p *DouyinPay) Create(ctx context.Context, args *CreateArgs) (*CreateResult, error) {
+func (p *DouyinPay) Create(ctx context.Context, args *CreateArgs) (res *CreateResult, err error) {
+	rec := newAudit(ProviderDouyin, AuditOutbound, "create", args.OrderID, args)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	paramsMap := map[string]any{
 		"oon":     args.OrderID,
 		"amount":  args.Money,
@@ -153,10 +156,14 @@ func (p *DouyinPay) Create(ctx context.Context, args *CreateArgs) (*CreateResult
 	}, nil
 }
 
-func (p *DouyinPay) Verify(ctx context.Context, args *VerifyArgs) (*VerifyRes, error) {
+func (p *DouyinPay) Verify(ctx context.Context, args *VerifyArgs) (vr *VerifyRes, err error) {
 	if args.Money <= 0 {
 		return nil, nil
 	}
+	// Query 单独记录, 这里记录金额或状态校验失败
+	rec := newAudit(ProviderDouyin, AuditOutbound, "verify", args.PayID, args)
+	defer func() { rec.finish(ctx, vr, err) }()
+
 	res, err := p.Query(ctx, args.PayID)
 	if err != nil {
 		return nil, err
@@ -168,6 +175,9 @@ func (p *DouyinPay) Verify(ctx context.Context, args *VerifyArgs) (*VerifyRes, e
 }
 
 func (p *DouyinPay) Query(ctx context.Context, payID string) (res *QueryResult, err error) {
+	rec := newAudit(ProviderDouyin, AuditOutbound, "query", payID, nil)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	m := map[string]any{"oon": payID}
 	sign := p.RequestSign(m)
 	var req = struct {
@@ -228,10 +238,14 @@ func (p *DouyinPay) RequestSign(paramsMap map[string]interface{}) string {
 
 // HandleNotify 负责处理抖音的回调
 func (p *DouyinPay) HandleNotify(req *http.Request, handler func(msg *NotifyMsg) (args *UpdateStatusArgs)) (args *UpdateStatusArgs, err error) {
+	rec := newAudit(ProviderDouyin, AuditInbound, "notify", "", nil)
+	defer func() { rec.finish(req.Context(), args, err) }()
+
 	var notifyResp NotifyResp
 	if err = json.NewDecoder(req.Body).Decode(&notifyResp); err != nil {
 		return nil, err
 	}
+	rec.setRequest(notifyResp)
 	// 验签
 	if !p.checkSign(&notifyResp) {
 		return nil, errors.New("callback sign error")
@@ -242,6 +256,8 @@ func (p *DouyinPay) HandleNotify(req *http.Request, handler func(msg *NotifyMsg)
 	if err != nil {
 		return nil, err
 	}
+	rec.setOrderID(notifyMsg.CpOrderNo)
+	rec.setRequest(notifyMsg)
 
 	return handler(&notifyMsg), err
 }
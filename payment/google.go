@@ -65,7 +65,15 @@ func NewGooglePay() (*GooglePay, error) {
 	}, nil
 }
 
-func (g *GooglePay) Verify(ctx context.Context, args *VerifyGooglePayArgs) (*VerifyGooglePayRes, error) {
+func (g *GooglePay) Verify(ctx context.Context, args *VerifyGooglePayArgs) (verifyRes *VerifyGooglePayRes, err error) {
+	rec := newAudit(ProviderGoogle, AuditOutbound, "verify", "", args)
+	defer func() {
+		if verifyRes != nil {
+			rec.setOrderID(verifyRes.TransactionID)
+		}
+		rec.finish(ctx, verifyRes, err)
+	}()
+
 	if args.Subscription {
 		return g.verifySub(ctx, args)
 	}
@@ -79,7 +87,7 @@ func (g *GooglePay) Verify(ctx context.Context, args *VerifyGooglePayArgs) (*Ver
 	if res.PurchaseState != 0 {
 		return nil, fmt.Errorf("wrong purchase state: %d", res.PurchaseState)
 	}
-	verifyRes := &VerifyGooglePayRes{TransactionID: res.OrderId}
+	verifyRes = &VerifyGooglePayRes{TransactionID: res.OrderId}
 	if res.PurchaseType != nil {
 		verifyRes.Sandbox = *res.PurchaseType == 0
 	}
@@ -130,7 +138,15 @@ type DeveloperNotification struct {
 	TestNotification           *playstore.TestNotification           `json:"testNotification"`
 }
 
-func (g *GooglePay) ParseNotify(ctx context.Context, body []byte) (*GooglePayNotification, error) {
+func (g *GooglePay) ParseNotify(ctx context.Context, body []byte) (res *GooglePayNotification, err error) {
+	rec := newAudit(ProviderGoogle, AuditInbound, "notify", "", nil)
+	defer func() {
+		if res != nil {
+			rec.setOrderID(res.OriginalTransactionID)
+		}
+		rec.finish(ctx, res, err)
+	}()
+
 	var gp GooglePub
 	if err := json.Unmarshal(body, &gp); err != nil {
 		return nil, err
@@ -146,7 +162,8 @@ func (g *GooglePay) ParseNotify(ctx context.Context, body []byte) (*GooglePayNot
 	if err = json.Unmarshal(decoded, &developerNotification); err != nil {
 		return nil, err
 	}
-	res := &GooglePayNotification{}
+	rec.setRequest(developerNotification)
+	res = &GooglePayNotification{}
 	if developerNotification.TestNotification != nil {
 		res.SubStatus = SubStatusTest
 		return res, nil
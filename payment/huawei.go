@@ -0,0 +1,265 @@
+package payment
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/awa/go-iap/hms"
+	"github.com/dmzlingyin/utils/config"
+	"time"
+)
+
+const (
+	HuaweiEventOrder        = "ORDER"
+	HuaweiEventSubscription = "SUBSCRIPTION"
+
+	// 订单通知类型: 1-支付成功 2-退款成功
+	HuaweiOrderPaid     int64 = 1
+	HuaweiOrderRefunded int64 = 2
+
+	huaweiSignPSS = "SHA256WithRSA/PSS"
+)
+
+type VerifyHuaweiPayArgs struct {
+	Subscription  bool
+	PurchaseToken string
+	ProductID     string // 订阅时为 subscriptionId
+	AccountFlag   int64  // 账号所在站点, 客户端 InAppPurchaseData 中的 accountFlag
+}
+
+type VerifyHuaweiPayRes struct {
+	Sandbox       bool
+	TransactionID string    // 交易ID
+	StartTime     time.Time // 订阅开始时间
+	ExpiryTime    time.Time // 订阅到期时间
+}
+
+type HuaweiPayNotification struct {
+	SubStatus             int32     `map:"sub_status"`
+	UUID                  string    `map:"uuid"`
+	TransactionID         string    `map:"tran_id"`
+	OriginalTransactionID string    `map:"org_tran_id"`
+	ProductID             string    `map:"product_id"`
+	StartTime             time.Time `map:"start"`
+	ExpiryTime            time.Time `map:"expiry"`
+	Sandbox               bool      `map:"sandbox"`
+}
+
+type HuaweiPurchaseData hms.InAppPurchaseData
+
+type HuaweiPay struct {
+	client    *hms.Client
+	publicKey string // IAP 公钥, 用于验证返回结果及通知的签名
+}
+
+func NewHuaweiPay() (*HuaweiPay, error) {
+	publicKey := config.GetString("pay.huawei.public_key")
+	if publicKey == "" {
+		return nil, errors.New("the public key of huawei iap is empty")
+	}
+	client := hms.New(
+		config.GetString("pay.huawei.client_id"),
+		config.GetString("pay.huawei.client_secret"),
+		config.GetString("pay.huawei.order_site_url"),
+		config.GetString("pay.huawei.subscription_site_url"),
+	)
+	return &HuaweiPay{
+		client:    client,
+		publicKey: publicKey,
+	}, nil
+}
+
+func (h *HuaweiPay) Verify(ctx context.Context, args *VerifyHuaweiPayArgs) (res *VerifyHuaweiPayRes, err error) {
+	rec := newAudit(ProviderHuawei, AuditOutbound, "verify", "", args)
+	defer func() {
+		if res != nil {
+			rec.setOrderID(res.TransactionID)
+		}
+		rec.finish(ctx, res, err)
+	}()
+
+	if args.Subscription {
+		return h.verifySub(ctx, args)
+	}
+
+	data, sign, err := h.client.GetOrderDataString(ctx, args.PurchaseToken, args.ProductID, args.AccountFlag)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyHuaweiSignature(h.publicKey, data, sign, ""); err != nil {
+		return nil, err
+	}
+	var pd HuaweiPurchaseData
+	if err = json.Unmarshal([]byte(data), &pd); err != nil {
+		return nil, err
+	}
+	// -1. 初始化 0. 已购买 1. 已取消 2. 已退款
+	if pd.PurchaseState != 0 {
+		return nil, fmt.Errorf("wrong purchase state: %d", pd.PurchaseState)
+	}
+	return &VerifyHuaweiPayRes{
+		Sandbox:       isHuaweiSandbox(&pd),
+		TransactionID: pd.OrderID,
+		StartTime:     time.UnixMilli(pd.PurchaseTime),
+	}, nil
+}
+
+func (h *HuaweiPay) verifySub(ctx context.Context, args *VerifyHuaweiPayArgs) (*VerifyHuaweiPayRes, error) {
+	pd, err := h.QuerySub(ctx, args.PurchaseToken, args.ProductID, args.AccountFlag)
+	if err != nil {
+		return nil, err
+	}
+	if !pd.SubIsValid {
+		return nil, errors.New("invalid subscription state")
+	}
+	return &VerifyHuaweiPayRes{
+		Sandbox:       isHuaweiSandbox(pd),
+		TransactionID: pd.OrderID,
+		StartTime:     time.UnixMilli(pd.PurchaseTime),
+		ExpiryTime:    time.UnixMilli(pd.ExpirationDate),
+	}, nil
+}
+
+// QuerySub 查询订阅的最新状态
+func (h *HuaweiPay) QuerySub(ctx context.Context, purchaseToken, subscriptionID string, accountFlag int64) (res *HuaweiPurchaseData, err error) {
+	rec := newAudit(ProviderHuawei, AuditOutbound, "query_sub", subscriptionID, map[string]any{"subscriptionId": subscriptionID, "accountFlag": accountFlag})
+	defer func() { rec.finish(ctx, res, err) }()
+
+	pd, err := h.client.VerifySubscription(ctx, purchaseToken, subscriptionID, accountFlag)
+	if err != nil {
+		return nil, err
+	}
+	return (*HuaweiPurchaseData)(&pd), nil
+}
+
+// ParseNotify 解析华为 IAP 服务端通知(v2), 订阅通知会校验签名, 订单通知会向华为查询订单信息
+func (h *HuaweiPay) ParseNotify(ctx context.Context, body []byte) (res *HuaweiPayNotification, err error) {
+	rec := newAudit(ProviderHuawei, AuditInbound, "notify", "", body)
+	defer func() {
+		if res != nil {
+			rec.setOrderID(res.TransactionID)
+		}
+		rec.finish(ctx, res, err)
+	}()
+
+	var n hms.SubscriptionNotificationV2
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, err
+	}
+
+	switch n.EventType {
+	case HuaweiEventSubscription:
+		return h.parseSubNotify(&n)
+	case HuaweiEventOrder:
+		return h.parseOrderNotify(ctx, &n)
+	default:
+		return nil, fmt.Errorf("invalid huawei event type: %s", n.EventType)
+	}
+}
+
+func (h *HuaweiPay) parseSubNotify(n *hms.SubscriptionNotificationV2) (*HuaweiPayNotification, error) {
+	sn := n.SubNotification
+	if err := verifyHuaweiSignature(h.publicKey, sn.StatusUpdateNotification, sn.NotificationSignature, sn.SignatureAlgorithm); err != nil {
+		return nil, err
+	}
+	var su hms.StatusUpdateNotification
+	if err := json.Unmarshal([]byte(sn.StatusUpdateNotification), &su); err != nil {
+		return nil, err
+	}
+	// 最新的收据信息同样需要验签
+	if err := verifyHuaweiSignature(h.publicKey, su.LatestReceiptInfo, su.LatestReceiptInfoSignature, su.SignatureAlgorithm); err != nil {
+		return nil, err
+	}
+	var pd HuaweiPurchaseData
+	if err := json.Unmarshal([]byte(su.LatestReceiptInfo), &pd); err != nil {
+		return nil, err
+	}
+
+	res := &HuaweiPayNotification{
+		UUID:                  fmt.Sprintf("%s_%d", su.OrderID, n.NotifyTime),
+		TransactionID:         pd.OrderID,
+		OriginalTransactionID: pd.SubscriptionID,
+		ProductID:             su.ProductID,
+		StartTime:             time.UnixMilli(pd.PurchaseTime),
+		ExpiryTime:            time.UnixMilli(pd.ExpirationDate),
+		Sandbox:               su.Environment == "SANDBOX" || isHuaweiSandbox(&pd),
+	}
+	switch su.NotificationType {
+	case hms.NotificationTypeRenewal, hms.NotificationTypeInteractiveRenewal,
+		hms.NotificationTypeRenewalRecurring, hms.NotificationTypeRenewalRestored:
+		res.SubStatus = SubStatusReNew
+	case hms.NotificationTypeCancel, hms.NotificationTypeRenewalStopped:
+		res.SubStatus = SubStatusCancelled
+	default:
+		res.SubStatus = SubStatusNone
+	}
+	return res, nil
+}
+
+func (h *HuaweiPay) parseOrderNotify(ctx context.Context, n *hms.SubscriptionNotificationV2) (*HuaweiPayNotification, error) {
+	on := n.OrderNotification
+	// 订单通知不带签名, 需要向华为查询(带签名的)订单数据
+	data, sign, err := h.client.GetOrderDataString(ctx, on.PurchaseToken, on.ProductID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyHuaweiSignature(h.publicKey, data, sign, ""); err != nil {
+		return nil, err
+	}
+	var pd HuaweiPurchaseData
+	if err = json.Unmarshal([]byte(data), &pd); err != nil {
+		return nil, err
+	}
+
+	res := &HuaweiPayNotification{
+		SubStatus:             SubStatusNone,
+		UUID:                  fmt.Sprintf("%s_%d", pd.OrderID, n.NotifyTime),
+		TransactionID:         pd.OrderID,
+		OriginalTransactionID: pd.OrderID,
+		ProductID:             on.ProductID,
+		StartTime:             time.UnixMilli(pd.PurchaseTime),
+		Sandbox:               isHuaweiSandbox(&pd),
+	}
+	// 退款视同取消
+	if on.NotificationType == HuaweiOrderRefunded {
+		res.SubStatus = SubStatusCancelled
+	}
+	return res, nil
+}
+
+func isHuaweiSandbox(pd *HuaweiPurchaseData) bool {
+	// purchaseType: 0-沙盒环境, 正式购买不返回该字段
+	return pd.PurchaseType != nil && *pd.PurchaseType == 0
+}
+
+// verifyHuaweiSignature 使用 IAP 公钥验证签名, 默认算法为 SHA256WithRSA
+func verifyHuaweiSignature(publicKey, data, signature, algorithm string) error {
+	if algorithm != huaweiSignPSS {
+		return hms.VerifySignature(publicKey, data, signature)
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return err
+	}
+	pub, err := x509.ParsePKIXPublicKey(keyBytes)
+	if err != nil {
+		return err
+	}
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("the public key of huawei iap must be rsa")
+	}
+	sign, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(data))
+	return rsa.VerifyPSS(rsaKey, crypto.SHA256, hashed[:], sign, nil)
+}
@@ -0,0 +1,73 @@
+package payment
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestHuaweiPayParseNotify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(data string) string {
+		hashed := sha256.Sum256([]byte(data))
+		s, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(s)
+	}
+
+	receipt := `{"orderId":"202401010001.2","subscriptionId":"1000","productId":"vip_month","purchaseTime":1700000000000,"expirationDate":1702592000000,"purchaseType":0,"subIsvalid":true}`
+	status, _ := json.Marshal(map[string]any{
+		"environment":                "SANDBOX",
+		"notificationType":           2,
+		"subscriptionId":             "1000",
+		"orderId":                    "202401010001.2",
+		"productId":                  "vip_month",
+		"latestReceiptInfo":          receipt,
+		"latestReceiptInfoSignature": sign(receipt),
+	})
+	body, _ := json.Marshal(map[string]any{
+		"version":    "v2",
+		"eventType":  HuaweiEventSubscription,
+		"notifyTime": 1702592000123,
+		"subNotification": map[string]any{
+			"statusUpdateNotification": string(status),
+			"notificationSignature":    sign(string(status)),
+		},
+	})
+
+	h := &HuaweiPay{publicKey: base64.StdEncoding.EncodeToString(pub)}
+	res, err := h.ParseNotify(context.Background(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SubStatus != SubStatusReNew || res.TransactionID != "202401010001.2" || res.OriginalTransactionID != "1000" || !res.Sandbox {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	// 篡改后的通知应验签失败
+	body, _ = json.Marshal(map[string]any{
+		"eventType": HuaweiEventSubscription,
+		"subNotification": map[string]any{
+			"statusUpdateNotification": string(status) + " ",
+			"notificationSignature":    sign(string(status)),
+		},
+	})
+	if _, err = h.ParseNotify(context.Background(), body); err == nil {
+		t.Fatal("tampered notification should be rejected")
+	}
+}
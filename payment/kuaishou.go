@@ -52,14 +52,18 @@ func newKuaishouPay(options map[string]string) (*KuaishouPay, error) {
 		appSecret: options[OptionSecret],
 		notifyURL: options[OptionNotifyURL],
 	}
-	if err := ks.refreshAT(); err != nil {
+	if err := ks.refreshAT(context.Background()); err != nil {
 		return nil, err
 	}
 	return ks, nil
 }
 
-func (p *KuaishouPay) Verify(ctx context.Context, args *VerifyArgs) (*VerifyRes, error) {
-	if err := p.refreshAT(); err != nil {
+func (p *KuaishouPay) Verify(ctx context.Context, args *VerifyArgs) (vr *VerifyRes, err error) {
+	// Query 单独记录, 这里记录金额或状态校验失败
+	rec := newAudit(ProviderKuaishou, AuditOutbound, "verify", args.PayID, args)
+	defer func() { rec.finish(ctx, vr, err) }()
+
+	if err := p.refreshAT(ctx); err != nil {
 		return nil, err
 	}
 	res, err := p.Query(ctx, args.PayID)
@@ -74,6 +78,9 @@ func (p *KuaishouPay) Verify(ctx context.Context, args *VerifyArgs) (*VerifyRes,
 }
 
 func (p *KuaishouPay) Query(ctx context.Context, payID string) (res *QueryResult, err error) {
+	rec := newAudit(ProviderKuaishou, AuditOutbound, "query", payID, nil)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	base := "https://open.kuaishou.com/openapi/mp/developer/epay/query_order"
 	queryUrl := fmt.Sprintf("%s?app_id=%s&access_token=%s", base, p.appID, p.at)
 	sign := p.SignVerify(payID)
@@ -124,15 +131,19 @@ func (p *KuaishouPay) Query(ctx context.Context, payID string) (res *QueryResult
 	}, err
 }
 
-func (p *KuaishouPay) refreshAT() error {
-	if p.at == "" || p.IsExpired() {
-		at, err := GetAccessToken(p.appID, p.appSecret)
-		if err != nil {
-			return err
-		}
-		p.at = at
-		p.preTime = time.Now()
+func (p *KuaishouPay) refreshAT(ctx context.Context) (err error) {
+	if p.at != "" && !p.IsExpired() {
+		return nil
 	}
+	rec := newAudit(ProviderKuaishou, AuditOutbound, "access_token", "", map[string]any{"appId": p.appID})
+	defer func() { rec.finish(ctx, nil, err) }()
+
+	at, err := GetAccessToken(p.appID, p.appSecret)
+	if err != nil {
+		return err
+	}
+	p.at = at
+	p.preTime = time.Now()
 	return nil
 }
 
@@ -174,7 +185,10 @@ func (p *KuaishouPay) SignVerify(oon string) string {
 }
 
 func (p *KuaishouPay) Create(ctx context.Context, args *CreateArgs) (orderRes *CreateResult, err error) {
-	if err := p.refreshAT(); err != nil {
+	rec := newAudit(ProviderKuaishou, AuditOutbound, "create", args.OrderID, args)
+	defer func() { rec.finish(ctx, orderRes, err) }()
+
+	if err := p.refreshAT(ctx); err != nil {
 		return nil, err
 	}
 
@@ -248,6 +262,9 @@ func (p *KuaishouPay) Sign(args *CreateArgs, goodsType, expireTime int32, notify
 
 // HandleNotify 负责处理快手的回调
 func (p *KuaishouPay) HandleNotify(req *http.Request, handler func(orderId, status string, amount int) (args *UpdateStatusArgs)) (args *UpdateStatusArgs, message string, err error) {
+	rec := newAudit(ProviderKuaishou, AuditInbound, "notify", "", nil)
+	defer func() { rec.finish(req.Context(), args, err) }()
+
 	var r = struct {
 		Data struct {
 			Channel         string `json:"channel"`
@@ -269,9 +286,11 @@ func (p *KuaishouPay) HandleNotify(req *http.Request, handler func(orderId, stat
 
 	var buf bytes.Buffer
 	io.Copy(&buf, req.Body)
+	rec.setRequest(buf.Bytes())
 	if err = json.Unmarshal(buf.Bytes(), &r); err != nil {
 		return nil, "", err
 	}
+	rec.setOrderID(r.Data.OutOrderNo)
 	// 验签
 	if !p.checkSign(string(buf.Bytes()), req.Header.Get("kwaisign")) {
 		return nil, "", errors.New("callback sign error")
@@ -39,7 +39,10 @@ func newPaypalPay(options map[string]string) (*PaypalPay, error) {
 	return pay, nil
 }
 
-func (p *PaypalPay) Verify(ctx context.Context, args *VerifyArgs) (*VerifyRes, error) {
+func (p *PaypalPay) Verify(ctx context.Context, args *VerifyArgs) (res *VerifyRes, err error) {
+	rec := newAudit(ProviderPaypal, AuditOutbound, "verify", args.PayID, args)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	order, err := p.OrderGet(ctx, args.PayID)
 	if err != nil {
 		return nil, err
@@ -61,6 +64,9 @@ func (p *PaypalPay) Verify(ctx context.Context, args *VerifyArgs) (*VerifyRes, e
 }
 
 func (p *PaypalPay) Create(ctx context.Context, args *CreateArgs) (res *CreateResult, err error) {
+	rec := newAudit(ProviderPaypal, AuditOutbound, "create", args.OrderID, args)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	client, err := p.getClient(ctx)
 	if err != nil {
 		return nil, err
@@ -97,7 +103,10 @@ func (p *PaypalPay) Create(ctx context.Context, args *CreateArgs) (res *CreateRe
 	}, nil
 }
 
-func (p *PaypalPay) Capture(ctx context.Context, orderID string, amount int32) (string, error) {
+func (p *PaypalPay) Capture(ctx context.Context, orderID string, amount int32) (status string, err error) {
+	rec := newAudit(ProviderPaypal, AuditOutbound, "capture", orderID, map[string]any{"amount": amount})
+	defer func() { rec.finish(ctx, status, err) }()
+
 	client, err := p.getClient(ctx)
 	if err != nil {
 		return "", err
@@ -131,6 +140,9 @@ func (p *PaypalPay) OrderGet(ctx context.Context, orderID string) (res *paypal.O
 }
 
 func (p *PaypalPay) Query(ctx context.Context, orderID string) (res *QueryResult, err error) {
+	rec := newAudit(ProviderPaypal, AuditOutbound, "query", orderID, nil)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	order, err := p.OrderGet(ctx, orderID)
 	unit := order.PurchaseUnits[0]
 
@@ -141,7 +153,10 @@ func (p *PaypalPay) Query(ctx context.Context, orderID string) (res *QueryResult
 	}, err
 }
 
-func (p *PaypalPay) CreateSub(ctx context.Context, args *CreateSubArgs) (*CreateSubResult, error) {
+func (p *PaypalPay) CreateSub(ctx context.Context, args *CreateSubArgs) (res *CreateSubResult, err error) {
+	rec := newAudit(ProviderPaypal, AuditOutbound, "create_sub", args.BizID, args)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	client, err := p.getClient(ctx)
 	if err != nil {
 		return nil, err
@@ -169,7 +184,10 @@ func (p *PaypalPay) CreateSub(ctx context.Context, args *CreateSubArgs) (*Create
 	}, nil
 }
 
-func (p *PaypalPay) QuerySub(ctx context.Context, args *QuerySubArgs) (*SubDetail, error) {
+func (p *PaypalPay) QuerySub(ctx context.Context, args *QuerySubArgs) (detail *SubDetail, err error) {
+	rec := newAudit(ProviderPaypal, AuditOutbound, "query_sub", args.SubID, args)
+	defer func() { rec.finish(ctx, detail, err) }()
+
 	client, err := p.getClient(ctx)
 	if err != nil {
 		return nil, err
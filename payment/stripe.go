@@ -26,6 +26,9 @@ func (p *StripePay) Verify(ctx context.Context, args *VerifyArgs) (*VerifyRes, e
 }
 
 func (p *StripePay) Create(ctx context.Context, args *CreateArgs) (res *CreateResult, err error) {
+	rec := newAudit(ProviderStripe, AuditOutbound, "create", args.OrderID, args)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	cancelURL := args.CancelURL
 	if cancelURL == "" {
 		cancelURL = p.cancelURL
@@ -64,7 +67,10 @@ func (p *StripePay) Create(ctx context.Context, args *CreateArgs) (res *CreateRe
 	return
 }
 
-func (p *StripePay) Capture(ctx context.Context, sessionID string, amount int32) (string, error) {
+func (p *StripePay) Capture(ctx context.Context, sessionID string, amount int32) (status string, err error) {
+	rec := newAudit(ProviderStripe, AuditOutbound, "capture", sessionID, map[string]any{"amount": amount})
+	defer func() { rec.finish(ctx, status, err) }()
+
 	s, err := p.client.CheckoutSessions.Get(sessionID, nil)
 	if err != nil {
 		return "", err
@@ -87,6 +93,9 @@ func (p *StripePay) Capture(ctx context.Context, sessionID string, amount int32)
 }
 
 func (p *StripePay) Query(ctx context.Context, orderID string) (res *QueryResult, err error) {
+	rec := newAudit(ProviderStripe, AuditOutbound, "query", orderID, nil)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	res = &QueryResult{}
 	s, err := p.client.CheckoutSessions.Get(orderID, nil)
 	if err != nil {
@@ -106,7 +115,10 @@ func (p *StripePay) Query(ctx context.Context, orderID string) (res *QueryResult
 	return
 }
 
-func (p *StripePay) CreateSub(ctx context.Context, args *CreateSubArgs) (*CreateSubResult, error) {
+func (p *StripePay) CreateSub(ctx context.Context, args *CreateSubArgs) (res *CreateSubResult, err error) {
+	rec := newAudit(ProviderStripe, AuditOutbound, "create_sub", args.BizID, args)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	cancelURL := args.CancelURL
 	if cancelURL == "" {
 		cancelURL = p.cancelURL
@@ -130,7 +142,7 @@ func (p *StripePay) CreateSub(ctx context.Context, args *CreateSubArgs) (*Create
 		},
 	}
 
-	res := &CreateSubResult{}
+	res = &CreateSubResult{}
 	if args.CustomerID == "" {
 		cusID, err := p.createCustomer(args.BizUserID)
 		if err == nil {
@@ -160,7 +172,10 @@ func (p *StripePay) createCustomer(bizUserID string) (string, error) {
 	return c.ID, nil
 }
 
-func (p *StripePay) QuerySub(_ context.Context, args *QuerySubArgs) (*SubDetail, error) {
+func (p *StripePay) QuerySub(ctx context.Context, args *QuerySubArgs) (res *SubDetail, err error) {
+	rec := newAudit(ProviderStripe, AuditOutbound, "query_sub", args.SubID, args)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	if args.SessionID != "" {
 		subID, err := p.getSubID(args.SessionID)
 		if err != nil {
@@ -195,7 +210,10 @@ func (p *StripePay) getSubID(sessionID string) (string, error) {
 	return s.Subscription.ID, nil
 }
 
-func (p *StripePay) CreatePortal(_ context.Context, args *CreatePortalArgs) (*CreatePortalResult, error) {
+func (p *StripePay) CreatePortal(ctx context.Context, args *CreatePortalArgs) (res *CreatePortalResult, err error) {
+	rec := newAudit(ProviderStripe, AuditOutbound, "create_portal", "", args)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	params := &stripe.BillingPortalSessionParams{
 		Customer:  stripe.String(args.CustomerID),
 		ReturnURL: stripe.String(args.ReturnURL),
@@ -127,7 +127,10 @@ func NewWechatPay() (*WechatPay, error) {
 }
 
 // PrePay 商户系统先调用该接口在微信支付服务后台生成预支付交易单，返回正确的预支付交易会话标识后再按Native、JSAPI、APP等不同场景生成交易串调起支付。
-func (p *WechatPay) PrePay(ctx context.Context, req *WechatPrepayReq) (*WechatPrepayResp, error) {
+func (p *WechatPay) PrePay(ctx context.Context, req *WechatPrepayReq) (res *WechatPrepayResp, err error) {
+	rec := newAudit(ProviderWechat, AuditOutbound, "prepay", req.OutTradeNo, req)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	switch req.PayType {
 	case WechatPayTypeApp:
 		return p.prepayApp(ctx, req)
@@ -255,7 +258,10 @@ func (p *WechatPay) prepayJsapi(ctx context.Context, req *WechatPrepayReq) (*Wec
 }
 
 // QueryOrderByID 根据订单号查询订单信息
-func (p *WechatPay) QueryOrderByID(ctx context.Context, id string) (*Transaction, error) {
+func (p *WechatPay) QueryOrderByID(ctx context.Context, id string) (res *Transaction, err error) {
+	rec := newAudit(ProviderWechat, AuditOutbound, "query", id, nil)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	resp, result, err := p.aas.QueryOrderById(ctx, app.QueryOrderByIdRequest{
 		TransactionId: core.String(id),
 		Mchid:         core.String(p.cfg.MchID),
@@ -270,7 +276,10 @@ func (p *WechatPay) QueryOrderByID(ctx context.Context, id string) (*Transaction
 }
 
 // QueryOrderByOutTradeNo 根据商户内部订单号查询订单信息
-func (p *WechatPay) QueryOrderByOutTradeNo(ctx context.Context, outTradeNo string) (*Transaction, error) {
+func (p *WechatPay) QueryOrderByOutTradeNo(ctx context.Context, outTradeNo string) (res *Transaction, err error) {
+	rec := newAudit(ProviderWechat, AuditOutbound, "query", outTradeNo, nil)
+	defer func() { rec.finish(ctx, res, err) }()
+
 	resp, result, err := p.aas.QueryOrderByOutTradeNo(ctx, app.QueryOrderByOutTradeNoRequest{
 		OutTradeNo: core.String(outTradeNo),
 		Mchid:      core.String(p.cfg.MchID),
@@ -285,13 +294,20 @@ func (p *WechatPay) QueryOrderByOutTradeNo(ctx context.Context, outTradeNo strin
 }
 
 // HandleNotify 处理回调通知
-func (p *WechatPay) HandleNotify(ctx context.Context, req *http.Request, handler func(t *Transaction) error) error {
+func (p *WechatPay) HandleNotify(ctx context.Context, req *http.Request, handler func(t *Transaction) error) (err error) {
+	rec := newAudit(ProviderWechat, AuditInbound, "notify", "", nil)
+	defer func() { rec.finish(ctx, nil, err) }()
+
 	// 解析请求
 	res := &Transaction{}
-	if _, err := p.nh.ParseNotifyRequest(ctx, req, res); err != nil {
+	if _, err = p.nh.ParseNotifyRequest(ctx, req, res); err != nil {
 		return err
 	}
-	if err := handler(res); err != nil {
+	if res.OutTradeNo != nil {
+		rec.setOrderID(*res.OutTradeNo)
+	}
+	rec.setRequest(res)
+	if err = handler(res); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,39 @@
+package router
+
+import (
+	"github.com/dmzlingyin/utils/oauth2/jwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// ClaimsKey 验证通过后 token 声明在 gin.Context 中的 key
+const ClaimsKey = "session_claims"
+
+// Auth 校验 Authorization 头中的 Bearer token, 并将声明保存到上下文中
+func Auth(issuer *jwt.Issuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+		claims, err := issuer.Verify(c.Request.Context(), token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// GetClaims 获取 Auth 中间件保存的声明, 未经过 Auth 时返回 nil
+func GetClaims(c *gin.Context) *jwt.SessionClaims {
+	v, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil
+	}
+	claims, _ := v.(*jwt.SessionClaims)
+	return claims
+}